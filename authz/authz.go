@@ -0,0 +1,142 @@
+// Package authz authorizes transactions by the certificate attributes of the submitting client,
+// such as role=auditor or department=finance. A chaincode declares a policy for each function
+// that needs one and checks it before the function runs.
+//
+// It is a module of its own, required by both the query and the service chaincode.
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ClientIdentity is the part of cid.ClientIdentity that policies need
+type ClientIdentity interface {
+	GetAttributeValue(attrName string) (value string, found bool, err error)
+}
+
+// Attribute is a certificate attribute and the value it must have
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+// Policy is satisfied by a client that carries every attribute of AllOf and,
+// unless AnyOf is empty, at least one attribute of AnyOf
+type Policy struct {
+	AllOf []Attribute
+	AnyOf []Attribute
+}
+
+// Policies maps the names of functions to their policies. Functions without a policy are open to every client.
+type Policies map[string]Policy
+
+// PermissionDeniedError is returned when the submitting client does not satisfy the policy of a function
+type PermissionDeniedError struct {
+	Function string
+	Reason   string
+}
+
+func (e *PermissionDeniedError) Error() string {
+	return fmt.Sprintf("permission denied for %s: %s", e.Function, e.Reason)
+}
+
+// IsPermissionDenied reports whether err is or wraps a PermissionDeniedError
+func IsPermissionDenied(err error) bool {
+	var denied *PermissionDeniedError
+	return errors.As(err, &denied)
+}
+
+// Require returns a policy satisfied by clients that carry every one of the attributes, given as name=value
+func Require(attributes ...string) Policy {
+	return Policy{AllOf: parseAttributes(attributes)}
+}
+
+// RequireAny returns a policy satisfied by clients that carry at least one of the attributes, given as name=value
+func RequireAny(attributes ...string) Policy {
+	return Policy{AnyOf: parseAttributes(attributes)}
+}
+
+// Check returns a PermissionDeniedError unless the client satisfies the policy
+func (p Policy) Check(function string, identity ClientIdentity) error {
+	for _, attribute := range p.AllOf {
+		ok, err := hasAttribute(identity, attribute)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &PermissionDeniedError{Function: function, Reason: fmt.Sprintf("the client does not carry the attribute %s", attribute)}
+		}
+	}
+
+	if len(p.AnyOf) == 0 {
+		return nil
+	}
+	for _, attribute := range p.AnyOf {
+		ok, err := hasAttribute(identity, attribute)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	var names []string
+	for _, attribute := range p.AnyOf {
+		names = append(names, attribute.String())
+	}
+	return &PermissionDeniedError{Function: function, Reason: fmt.Sprintf("the client carries none of the attributes %s", strings.Join(names, ", "))}
+}
+
+// Check returns a PermissionDeniedError unless the client satisfies the policy of the function
+func (p Policies) Check(function string, identity ClientIdentity) error {
+	policy, ok := p[function]
+	if !ok {
+		return nil
+	}
+
+	return policy.Check(function, identity)
+}
+
+// BeforeTransaction returns a handler for contractapi.Contract.BeforeTransaction
+// that checks the policy of the function being invoked
+func (p Policies) BeforeTransaction() func(ctx contractapi.TransactionContextInterface) error {
+	return func(ctx contractapi.TransactionContextInterface) error {
+		function, _ := ctx.GetStub().GetFunctionAndParameters()
+
+		// Functions of a named contract are invoked as name:function
+		function = function[strings.LastIndex(function, ":")+1:]
+
+		return p.Check(function, ctx.GetClientIdentity())
+	}
+}
+
+func (a Attribute) String() string {
+	return a.Name + "=" + a.Value
+}
+
+func hasAttribute(identity ClientIdentity, attribute Attribute) (bool, error) {
+	value, found, err := identity.GetAttributeValue(attribute.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to get attribute %s: %v", attribute.Name, err)
+	}
+
+	return found && value == attribute.Value, nil
+}
+
+func parseAttributes(attributes []string) []Attribute {
+	parsed := make([]Attribute, 0, len(attributes))
+	for _, attribute := range attributes {
+		name, value := attribute, ""
+		if i := strings.Index(attribute, "="); i >= 0 {
+			name, value = attribute[:i], attribute[i+1:]
+		}
+		parsed = append(parsed, Attribute{Name: name, Value: value})
+	}
+
+	return parsed
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for credit balances and allowances
+const creditBalancePrefix = "creditBalance"
+const creditAllowancePrefix = "creditAllowance"
+
+// Define key names for credit token options
+const creditNameKey = "creditName"
+const creditSymbolKey = "creditSymbol"
+const creditDecimalsKey = "creditDecimals"
+const creditIssuerMSPIDKey = "creditIssuerMSPID"
+const creditTotalSupplyKey = "creditTotalSupply"
+
+// Clients that mint credits carry role=issuer on top of belonging to the issuer MSP
+const creditIssuerRole = "issuer"
+
+// CreditTokenContract is a fungible (ERC-20 style) credit token used to pay for queries.
+// It runs in the query chaincode so that CreateQuery can charge for a query in the same transaction.
+// Accounts are client identities in the same format as Query.InitiatorID.
+type CreditTokenContract struct {
+	contractapi.Contract
+}
+
+// CreditTransfer is the payload of the Transfer event
+type CreditTransfer struct {
+	From  string `json:"From"`
+	To    string `json:"To"`
+	Value int    `json:"Value"`
+}
+
+// CreditApproval is the payload of the Approval event
+type CreditApproval struct {
+	Owner   string `json:"Owner"`
+	Spender string `json:"Spender"`
+	Value   int    `json:"Value"`
+}
+
+// Initialize sets the name, symbol and decimals of the credit token and the MSP allowed to mint it.
+// It can only be called once, by a client of the issuer MSP.
+func (c *CreditTokenContract) Initialize(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals int, issuerMSPID string) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+	if clientMSPID != issuerMSPID {
+		return fmt.Errorf("client is not authorized to initialize the contract")
+	}
+
+	issuer, err := getConfig(ctx, creditIssuerMSPIDKey)
+	if err != nil {
+		return err
+	}
+	if issuer != "" {
+		return fmt.Errorf("contract options are already set, client is not authorized to change them")
+	}
+
+	if decimals < 0 {
+		return fmt.Errorf("decimals must not be negative")
+	}
+
+	options := []struct {
+		name  string
+		value string
+	}{
+		{creditNameKey, name},
+		{creditSymbolKey, symbol},
+		{creditDecimalsKey, strconv.Itoa(decimals)},
+		{creditIssuerMSPIDKey, issuerMSPID},
+		{creditTotalSupplyKey, "0"},
+	}
+	for _, option := range options {
+		err = putConfig(ctx, option.name, option.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Name returns the name of the credit token
+func (c *CreditTokenContract) Name(ctx contractapi.TransactionContextInterface) (string, error) {
+	return getRequiredConfig(ctx, creditNameKey)
+}
+
+// Symbol returns the symbol of the credit token
+func (c *CreditTokenContract) Symbol(ctx contractapi.TransactionContextInterface) (string, error) {
+	return getRequiredConfig(ctx, creditSymbolKey)
+}
+
+// Decimals returns the number of decimals used to display amounts of the credit token
+func (c *CreditTokenContract) Decimals(ctx contractapi.TransactionContextInterface) (int, error) {
+	decimals, err := getRequiredConfig(ctx, creditDecimalsKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(decimals)
+}
+
+// IssuerMSPID returns the MSP allowed to mint the credit token
+func (c *CreditTokenContract) IssuerMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	return getRequiredConfig(ctx, creditIssuerMSPIDKey)
+}
+
+// TotalSupply returns the amount of credits in existence
+func (c *CreditTokenContract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
+	totalSupply, err := getRequiredConfig(ctx, creditTotalSupplyKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(totalSupply)
+}
+
+// Mint creates credits in the account of the submitting client and emits a Transfer event from "0x0".
+// Only clients of the issuer MSP with the issuer role may call it.
+func (c *CreditTokenContract) Mint(ctx contractapi.TransactionContextInterface, amount int) error {
+	issuerMSPID, err := getRequiredConfig(ctx, creditIssuerMSPIDKey)
+	if err != nil {
+		return err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+	if clientMSPID != issuerMSPID {
+		return fmt.Errorf("client from org %s is not authorized to mint credits", clientMSPID)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("mint amount must be a positive integer")
+	}
+
+	minter, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	totalSupply, err := c.TotalSupply(ctx)
+	if err != nil {
+		return err
+	}
+	totalSupply, err = addCredits(totalSupply, amount)
+	if err != nil {
+		return err
+	}
+
+	balance, err := readCreditBalance(ctx, minter)
+	if err != nil {
+		return err
+	}
+	balance, err = addCredits(balance, amount)
+	if err != nil {
+		return err
+	}
+
+	err = putCreditBalance(ctx, minter, balance)
+	if err != nil {
+		return err
+	}
+
+	err = putConfig(ctx, creditTotalSupplyKey, strconv.Itoa(totalSupply))
+	if err != nil {
+		return err
+	}
+
+	return emitCreditTransfer(ctx, "0x0", minter, amount)
+}
+
+// Transfer moves credits from the account of the submitting client to a recipient and emits a Transfer event
+func (c *CreditTokenContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount int) error {
+	sender, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = transferCredits(ctx, sender, recipient, amount)
+	if err != nil {
+		return err
+	}
+
+	return emitCreditTransfer(ctx, sender, recipient, amount)
+}
+
+// BalanceOf returns the credit balance of an account
+func (c *CreditTokenContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+	_, err := getRequiredConfig(ctx, creditIssuerMSPIDKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return readCreditBalance(ctx, account)
+}
+
+// ClientAccountBalance returns the credit balance of the submitting client
+func (c *CreditTokenContract) ClientAccountBalance(ctx contractapi.TransactionContextInterface) (int, error) {
+	account, err := getClientIdentity(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.BalanceOf(ctx, account)
+}
+
+// ClientAccountID returns the account of the submitting client
+func (c *CreditTokenContract) ClientAccountID(ctx contractapi.TransactionContextInterface) (string, error) {
+	return getClientIdentity(ctx)
+}
+
+// Approve allows a spender to transfer up to value credits from the account of the submitting client
+// and emits an Approval event. A new approval replaces the previous one.
+func (c *CreditTokenContract) Approve(ctx contractapi.TransactionContextInterface, spender string, value int) error {
+	_, err := getRequiredConfig(ctx, creditIssuerMSPIDKey)
+	if err != nil {
+		return err
+	}
+
+	if value < 0 {
+		return fmt.Errorf("allowance must not be negative")
+	}
+
+	owner, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = putCreditAllowance(ctx, owner, spender, value)
+	if err != nil {
+		return err
+	}
+
+	approvalBytes, err := json.Marshal(CreditApproval{Owner: owner, Spender: spender, Value: value})
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent("Approval", approvalBytes)
+	if err != nil {
+		return fmt.Errorf("failed to SetEvent Approval: %v", err)
+	}
+
+	return nil
+}
+
+// Allowance returns the amount a spender may still transfer from the account of an owner
+func (c *CreditTokenContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (int, error) {
+	_, err := getRequiredConfig(ctx, creditIssuerMSPIDKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return readCreditAllowance(ctx, owner, spender)
+}
+
+// TransferFrom moves credits from an account that approved the submitting client to a recipient,
+// lowers the allowance accordingly and emits a Transfer event
+func (c *CreditTokenContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+	spender, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	allowance, err := readCreditAllowance(ctx, from, spender)
+	if err != nil {
+		return err
+	}
+	if allowance < value {
+		return fmt.Errorf("spender does not have enough allowance for transfer")
+	}
+
+	err = transferCredits(ctx, from, to, value)
+	if err != nil {
+		return err
+	}
+
+	err = putCreditAllowance(ctx, from, spender, allowance-value)
+	if err != nil {
+		return err
+	}
+
+	return emitCreditTransfer(ctx, from, to, value)
+}
+
+// transferCredits moves credits between two accounts without emitting an event
+func transferCredits(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+	_, err := getRequiredConfig(ctx, creditIssuerMSPIDKey)
+	if err != nil {
+		return err
+	}
+
+	if from == to {
+		return fmt.Errorf("cannot transfer to and from same client account")
+	}
+	if value < 0 {
+		return fmt.Errorf("transfer amount cannot be negative")
+	}
+
+	fromBalance, err := readCreditBalance(ctx, from)
+	if err != nil {
+		return err
+	}
+	if fromBalance < value {
+		return fmt.Errorf("account %s has insufficient funds", from)
+	}
+
+	toBalance, err := readCreditBalance(ctx, to)
+	if err != nil {
+		return err
+	}
+	toBalance, err = addCredits(toBalance, value)
+	if err != nil {
+		return err
+	}
+
+	err = putCreditBalance(ctx, from, fromBalance-value)
+	if err != nil {
+		return err
+	}
+
+	return putCreditBalance(ctx, to, toBalance)
+}
+
+// addCredits adds two amounts and fails on overflow
+func addCredits(a int, b int) (int, error) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, fmt.Errorf("math: addition overflow occurred %d + %d", a, b)
+	}
+
+	return sum, nil
+}
+
+func readCreditBalance(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(creditBalancePrefix, []string{account})
+	if err != nil {
+		return 0, fmt.Errorf("failed to CreateCompositeKey %s: %v", creditBalancePrefix, err)
+	}
+
+	balanceBytes, err := ctx.GetStub().GetState(balanceKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if balanceBytes == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(balanceBytes))
+}
+
+func putCreditBalance(ctx contractapi.TransactionContextInterface, account string, balance int) error {
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(creditBalancePrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", creditBalancePrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(balanceKey, []byte(strconv.Itoa(balance)))
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", balanceKey, err)
+	}
+
+	return nil
+}
+
+func readCreditAllowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (int, error) {
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(creditAllowancePrefix, []string{owner, spender})
+	if err != nil {
+		return 0, fmt.Errorf("failed to CreateCompositeKey %s: %v", creditAllowancePrefix, err)
+	}
+
+	allowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if allowanceBytes == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(allowanceBytes))
+}
+
+func putCreditAllowance(ctx contractapi.TransactionContextInterface, owner string, spender string, value int) error {
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(creditAllowancePrefix, []string{owner, spender})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", creditAllowancePrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(value)))
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", allowanceKey, err)
+	}
+
+	return nil
+}
+
+func emitCreditTransfer(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+	transferBytes, err := json.Marshal(CreditTransfer{From: from, To: to, Value: value})
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent("Transfer", transferBytes)
+	if err != nil {
+		return fmt.Errorf("failed to SetEvent Transfer: %v", err)
+	}
+
+	return nil
+}
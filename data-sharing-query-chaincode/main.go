@@ -2,9 +2,13 @@
 SPDX-License-Identifier: Apache-2.0
 */
 
+//go:generate go run ./tools/collectionsgen -orgs Org1MSP,Org2MSP -out collections_config.json
+
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -21,17 +25,25 @@ type QuerySmartContract struct {
 // Insert struct field in alphabetic order => to achieve determinism across languages
 // golang keeps the order when marshal to json but doesn't order automatically
 type Query struct {
-	Certificate    string `json:"Certificate"`
-	DataDigest     string `json:"DataDigest"`
-	DataRows       int    `json:"DatatRows"`
-	InitiatorID    string `json:"InitiatorID"`
-	InitiatorMSPID string `json:"InitiatorMSPID"`
-	Legitimacy     string `json:"Legitimacy"`
-	QueriedTable   string `json:"QueriedTable"`
-	QueryDigest    string `json:"QueryDigest"`
-	QueryID        string `json:"QueryID"`
-	ServiceID      string `json:"ServiceID"`
-	Timestamp      int    `json:"Timestamp"`
+	CardTokenID      string  `json:"CardTokenID"`
+	CertificateHash  string  `json:"CertificateHash"`
+	Charge           int     `json:"Charge"`
+	DataDigest       string  `json:"DataDigest"`
+	DataRows         int     `json:"DatatRows"`
+	DocType          string  `json:"DocType"`
+	Epsilon          float64 `json:"Epsilon"`
+	InitiatorID      string  `json:"InitiatorID"`
+	InitiatorMSPID   string  `json:"InitiatorMSPID"`
+	Legitimacy       string  `json:"Legitimacy"`
+	PreviousHash     string  `json:"PreviousHash"`
+	QueriedTableHash string  `json:"QueriedTableHash"`
+	QueryDigestHash  string  `json:"QueryDigestHash"`
+	QueryID          string  `json:"QueryID"`
+	Sequence         int     `json:"Sequence"`
+	ServiceID        string  `json:"ServiceID"`
+	SubmitterID      string  `json:"SubmitterID"`
+	SubmitterMSPID   string  `json:"SubmitterMSPID"`
+	Timestamp        int     `json:"Timestamp"`
 }
 
 // InitLedger adds a base set of querys to the ledger
@@ -40,28 +52,114 @@ func (s *QuerySmartContract) InitLedger(ctx contractapi.TransactionContextInterf
 }
 
 // CreateQuery issues a new query to the world state with given details.
-func (s *QuerySmartContract) CreateQuery(ctx contractapi.TransactionContextInterface, certificate, dataDigest string, dataRows int, initiatorID, initiatorMSPID, legitimacy, queriedTable, queryDigest, queryID, serviceID string, timestamp int) error {
-	exists, err := s.QueryExists(ctx, queryID)
+// The initiator is the submitting client and the timestamp is the transaction timestamp.
+// The query starts pending legitimacy review by an auditor.
+// Certificate, QueriedTable, QueryDigest, Salt and Signature are passed in the transient map under "query_properties"
+// and stored in the initiator's private data collection; only their hashes, keyed with Salt, are written to world state.
+// Certificate must chain to the initiator's MSP, belong to the initiator, and have signed QueryDigest.
+// The initiator must hold a card for the service in the service chaincode; its token ID is recorded.
+// The initiator's MSP must hold an active consent from the owner of QueriedTable.
+// A noisy aggregate query passes its epsilon cost, which is deducted from the initiator MSP's
+// privacy budget on QueriedTable; other queries pass 0.
+// If the service has a price, the query is paid for in credits by the initiator; the Query event reports it as Charge.
+func (s *QuerySmartContract) CreateQuery(ctx contractapi.TransactionContextInterface, dataDigest string, dataRows int, epsilon float64, queryID, serviceID string) error {
+	details, err := getQueryTransientInput(ctx)
 	if err != nil {
 		return err
 	}
-	if exists {
-		return fmt.Errorf("the query %s already exists", queryID)
+
+	initiatorID, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	initiatorMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSPID: %v", err)
 	}
 
 	query := Query{
-		Certificate:    certificate,
 		DataDigest:     dataDigest,
 		DataRows:       dataRows,
+		Epsilon:        epsilon,
 		InitiatorID:    initiatorID,
 		InitiatorMSPID: initiatorMSPID,
-		Legitimacy:     legitimacy,
-		QueriedTable:   queriedTable,
-		QueryDigest:    queryDigest,
 		QueryID:        queryID,
 		ServiceID:      serviceID,
-		Timestamp:      timestamp,
+		SubmitterID:    initiatorID,
+		SubmitterMSPID: initiatorMSPID,
+	}
+
+	return s.putQuery(ctx, &query, details)
+}
+
+// putQuery stamps a new query with the transaction timestamp and the hashes of its private details,
+// links it to the hash chain of its service, stores it with its indexes and private details,
+// and emits the Query event
+func (s *QuerySmartContract) putQuery(ctx contractapi.TransactionContextInterface, query *Query, details *QueryPrivateDetails) error {
+	exists, err := s.QueryExists(ctx, query.QueryID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the query %s already exists", query.QueryID)
+	}
+
+	dataDigest, err := hex.DecodeString(query.DataDigest)
+	if err != nil || len(dataDigest) != sha256.Size {
+		return fmt.Errorf("DataDigest must be the hex encoded Merkle root of the result rows")
+	}
+	if query.DataRows < 0 {
+		return fmt.Errorf("DataRows must not be negative")
+	}
+
+	err = s.verifyQuerySignature(ctx, query, details)
+	if err != nil {
+		return err
+	}
+
+	query.CardTokenID, err = findCard(ctx, query.InitiatorID, query.ServiceID)
+	if err != nil {
+		return err
+	}
+
+	err = checkConsent(ctx, hashField(details.QueriedTable), query.InitiatorMSPID)
+	if err != nil {
+		return err
+	}
+
+	err = spendPrivacyBudget(ctx, query, hashField(details.QueriedTable))
+	if err != nil {
+		return err
+	}
+
+	err = chargeQuery(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	err = consumeQuota(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	timestamp, err := getTxTimestamp(ctx)
+	if err != nil {
+		return err
 	}
+
+	query.CertificateHash = hashPrivateField(details.Salt, details.Certificate)
+	query.DocType = queryDocType
+	query.Legitimacy = legitimacyPending
+	query.QueriedTableHash = hashPrivateField(details.Salt, details.QueriedTable)
+	query.QueryDigestHash = hashPrivateField(details.Salt, details.QueryDigest)
+	query.Timestamp = timestamp
+
+	err = linkQuery(ctx, query)
+	if err != nil {
+		return err
+	}
+
 	queryBytes, err := json.Marshal(query)
 	if err != nil {
 		return err
@@ -72,68 +170,114 @@ func (s *QuerySmartContract) CreateQuery(ctx contractapi.TransactionContextInter
 		return fmt.Errorf("failed to SetEvent CreateQuery: %v", err)
 	}
 
-	return ctx.GetStub().PutState(queryID, queryBytes)
+	key, err := queryKey(ctx, query.QueryID)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, queryBytes)
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", query.QueryID, err)
+	}
+
+	err = putQueryIndexes(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	err = putQueryChainLink(ctx, query, queryBytes)
+	if err != nil {
+		return err
+	}
+
+	details.QueryID = query.QueryID
+	return putQueryPrivateDetails(ctx, query.InitiatorMSPID, details)
 }
 
 // ReadQuery returns the query stored in the world state with given id.
+// A query not yet moved by MigrateQueryKeys is read from its ID.
 func (s *QuerySmartContract) ReadQuery(ctx contractapi.TransactionContextInterface, queryID string) (*Query, error) {
-	queryBytes, err := ctx.GetStub().GetState(queryID)
+	query, _, err := readQuery(ctx, queryID)
+	return query, err
+}
+
+// readQuery returns the query with given id and whether it is still stored at its ID by an earlier version
+func readQuery(ctx contractapi.TransactionContextInterface, queryID string) (*Query, bool, error) {
+	key, err := queryKey(ctx, queryID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
+		return nil, false, err
+	}
+
+	queryBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read from world state: %v", err)
 	}
 	if queryBytes == nil {
-		return nil, fmt.Errorf("the query %s does not exist", queryID)
+		legacy, err := readLegacyQuery(ctx, queryID)
+		if err != nil {
+			return nil, false, err
+		}
+		if legacy == nil {
+			return nil, false, fmt.Errorf("the query %s does not exist", queryID)
+		}
+		return &legacy.Query, true, nil
 	}
 
 	var query Query
 	err = json.Unmarshal(queryBytes, &query)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return &query, nil
+	return &query, false, nil
 }
 
-// QueryExists returns true when query with given ID exists in world state
+// QueryExists returns true when query with given ID exists in world state.
+// A query not yet moved by MigrateQueryKeys still holds its ID.
 func (s *QuerySmartContract) QueryExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	queryBytes, err := ctx.GetStub().GetState(id)
+	key, err := queryKey(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	queryBytes, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return false, fmt.Errorf("failed to read from world state: %v", err)
 	}
+	if queryBytes != nil {
+		return true, nil
+	}
 
-	return queryBytes != nil, nil
+	legacyBytes, err := ctx.GetStub().GetState(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+
+	return legacyBytes != nil, nil
 }
 
 // GetAllQuerys returns all querys found in world state
 func (s *QuerySmartContract) GetAllQuerys(ctx contractapi.TransactionContextInterface) ([]*Query, error) {
-	// range query with empty string for startKey and endKey does an
-	// open-ended query of all querys in the chaincode namespace.
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	// a partial composite key query with no attributes returns
+	// every query record and nothing else in the chaincode namespace.
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(queryPrefix, []string{})
 	if err != nil {
 		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	var querys []*Query
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
-
-		var query Query
-		err = json.Unmarshal(queryResponse.Value, &query)
-		if err != nil {
-			return nil, err
-		}
-		querys = append(querys, &query)
-	}
-
-	return querys, nil
+	return constructQuerysFromIterator(resultsIterator)
 }
 
 func main() {
-	queryChaincode, err := contractapi.NewChaincode(&QuerySmartContract{})
+	queryContract := new(QuerySmartContract)
+	queryContract.BeforeTransaction = queryPolicies.BeforeTransaction()
+
+	creditContract := new(CreditTokenContract)
+	creditContract.Contract.Name = "credit"
+	creditContract.BeforeTransaction = creditPolicies.BeforeTransaction()
+
+	queryChaincode, err := contractapi.NewChaincode(queryContract, creditContract)
 	if err != nil {
 		log.Panicf("Error creating data-service-querying chaincode: %v", err)
 	}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// Names used by the test network
+const testMSPID = "Org1MSP"
+const testServiceID = "service1"
+const testProviderMSPID = "Org2MSP"
+const testTable = "patients"
+const testCardsChaincode = "cards"
+
+// newTestContext returns a transaction context over a fresh MockStub inside a started transaction
+func newTestContext() (*contractapi.TransactionContext, *shimtest.MockStub) {
+	stub := shimtest.NewMockStub("query", nil)
+	stub.MockTransactionStart("tx1")
+
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+	return ctx, stub
+}
+
+// testCA is the certificate authority of an MSP of the test network
+type testCA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca.org1.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+	}
+}
+
+// testClient is an enrolled client of the test network
+type testClient struct {
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+	mspID   string
+}
+
+// enroll issues a certificate in an organizational unit, carrying attributes the way Fabric CA does
+func (ca *testCA) enroll(t *testing.T, commonName string, ou string, attrs map[string]string) *testClient {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: []string{ou}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if len(attrs) > 0 {
+		attrsBytes, err := json.Marshal(map[string]interface{}{"attrs": attrs})
+		require.NoError(t, err)
+		template.ExtraExtensions = []pkix.Extension{{Id: []int{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: attrsBytes}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return &testClient{
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+		mspID:   testMSPID,
+	}
+}
+
+// id returns the identity of the client as getClientIdentity sees it
+func (c *testClient) id(t *testing.T) string {
+	id, err := certificateIdentity(c.mspID, string(c.certPEM))
+	require.NoError(t, err)
+	return id
+}
+
+// details returns the private details of a query signed by the client, with a random salt
+func (c *testClient) details(t *testing.T, queryID string, queryDigest string) *QueryPrivateDetails {
+	hash := sha256.Sum256([]byte(queryDigest))
+	signature, err := ecdsa.SignASN1(rand.Reader, c.key, hash[:])
+	require.NoError(t, err)
+
+	salt := make([]byte, 16)
+	_, err = rand.Read(salt)
+	require.NoError(t, err)
+
+	return &QueryPrivateDetails{
+		Certificate:  string(c.certPEM),
+		QueriedTable: testTable,
+		QueryDigest:  queryDigest,
+		QueryID:      queryID,
+		Salt:         hex.EncodeToString(salt),
+		Signature:    base64.StdEncoding.EncodeToString(signature),
+	}
+}
+
+// testStub is a MockStub that answers CouchDB selector queries over its world state when couchDB is set.
+// MockStub has no query engine, and hands itself rather than a wrapper to the chaincode, so transactions
+// are run through invoke. When now is set, transactions are timestamped with it instead of the wall clock.
+// Every write is recorded, so that the stub can answer GetHistoryForKey.
+type testStub struct {
+	*shimtest.MockStub
+	args      [][]byte
+	chaincode shim.Chaincode
+	couchDB   bool
+	history   map[string][]*queryresult.KeyModification
+	now       time.Time
+}
+
+func newTestStub(name string, chaincode shim.Chaincode) *testStub {
+	return &testStub{
+		MockStub:  shimtest.NewMockStub(name, chaincode),
+		chaincode: chaincode,
+		history:   map[string][]*queryresult.KeyModification{},
+	}
+}
+
+// invoke runs a transaction like MockStub.MockInvoke
+func (s *testStub) invoke(txID string, args [][]byte) peer.Response {
+	s.args = args
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+	if !s.now.IsZero() {
+		s.TxTimestamp = &timestamp.Timestamp{Seconds: s.now.Unix()}
+	}
+	return s.chaincode.Invoke(s)
+}
+
+func (s *testStub) PutState(key string, value []byte) error {
+	err := s.MockStub.PutState(key, value)
+	if err == nil {
+		s.history[key] = append(s.history[key], &queryresult.KeyModification{TxId: s.TxID, Value: value, Timestamp: s.TxTimestamp})
+	}
+	return err
+}
+
+func (s *testStub) DelState(key string) error {
+	err := s.MockStub.DelState(key)
+	if err == nil {
+		s.history[key] = append(s.history[key], &queryresult.KeyModification{TxId: s.TxID, Timestamp: s.TxTimestamp, IsDelete: true})
+	}
+	return err
+}
+
+// GetHistoryForKey returns the recorded writes of a key newest first, as the peers do
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	var modifications []*queryresult.KeyModification
+	for i := len(s.history[key]) - 1; i >= 0; i-- {
+		modifications = append(modifications, s.history[key][i])
+	}
+	return &testHistoryIterator{modifications: modifications}, nil
+}
+
+func (s *testStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *testStub) GetStringArgs() []string {
+	var args []string
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *testStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	if !s.couchDB {
+		return s.MockStub.GetQueryResult(query)
+	}
+
+	results, err := s.selectDocuments(query)
+	if err != nil {
+		return nil, err
+	}
+	return &testIterator{results: results}, nil
+}
+
+// GetQueryResultWithPagination pages through the documents a selector matches. Bookmarks are offsets.
+func (s *testStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if !s.couchDB {
+		return s.MockStub.GetQueryResultWithPagination(query, pageSize, bookmark)
+	}
+
+	results, err := s.selectDocuments(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := 0
+	if bookmark != "" {
+		start, err = strconv.Atoi(bookmark)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid bookmark %q", bookmark)
+		}
+	}
+	start = min(start, len(results))
+	end := min(start+int(pageSize), len(results))
+
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(end - start), Bookmark: strconv.Itoa(end)}
+	return &testIterator{results: results[start:end]}, metadata, nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination pages through composite keys like LevelDB does: a page starts
+// at the bookmark, and the bookmark of the next page is the key that follows it, empty after the last page
+func (s *testStub) GetStateByPartialCompositeKeyWithPagination(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	prefix, err := s.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	startKey := prefix
+	if bookmark != "" {
+		startKey = bookmark
+	}
+	iterator := shimtest.NewMockStateRangeQueryIterator(s.MockStub, startKey, prefix+string(utf8.MaxRune))
+
+	var results []*queryresult.KV
+	nextBookmark := ""
+	for iterator.HasNext() {
+		result, err := iterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(results) == int(pageSize) {
+			nextBookmark = result.Key
+			break
+		}
+		results = append(results, result)
+	}
+
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(results)), Bookmark: nextBookmark}
+	return &testIterator{results: results}, metadata, nil
+}
+
+// GetPrivateDataByPartialCompositeKey iterates over the composite keys of a collection, which MockStub does not implement
+func (s *testStub) GetPrivateDataByPartialCompositeKey(collection string, objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := s.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range s.PvtState[collection] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var results []*queryresult.KV
+	for _, key := range keys {
+		results = append(results, &queryresult.KV{Namespace: s.Name, Key: key, Value: s.PvtState[collection][key]})
+	}
+	return &testIterator{results: results}, nil
+}
+
+// selectDocuments returns, in key order, the JSON documents of the world state that a CouchDB query selects.
+// Selectors may test fields for equality or with the $eq, $gt, $gte, $lt and $lte operators.
+func (s *testStub) selectDocuments(query string) ([]*queryresult.KV, error) {
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	err := json.Unmarshal([]byte(query), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %s: %v", query, err)
+	}
+
+	var results []*queryresult.KV
+	for element := s.Keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(string)
+
+		var document map[string]interface{}
+		if json.Unmarshal(s.State[key], &document) != nil {
+			continue
+		}
+
+		selected, err := matchesSelector(document, parsed.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if selected {
+			results = append(results, &queryresult.KV{Namespace: s.Name, Key: key, Value: s.State[key]})
+		}
+	}
+
+	return results, nil
+}
+
+func matchesSelector(document map[string]interface{}, selector map[string]interface{}) (bool, error) {
+	for field, condition := range selector {
+		value, found := document[field]
+		operators, ok := condition.(map[string]interface{})
+		if !ok {
+			operators = map[string]interface{}{"$eq": condition}
+		}
+
+		for operator, operand := range operators {
+			if !found {
+				return false, nil
+			}
+			matched, err := compareJSON(operator, value, operand)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+	}
+
+	return true, nil
+}
+
+func compareJSON(operator string, value interface{}, operand interface{}) (bool, error) {
+	var order int
+	switch operand := operand.(type) {
+	case float64:
+		number, ok := value.(float64)
+		if !ok {
+			return false, nil
+		}
+		if number < operand {
+			order = -1
+		} else if number > operand {
+			order = 1
+		}
+	case string:
+		text, ok := value.(string)
+		if !ok {
+			return false, nil
+		}
+		order = strings.Compare(text, operand)
+	default:
+		return operator == "$eq" && value == operand, nil
+	}
+
+	switch operator {
+	case "$eq":
+		return order == 0, nil
+	case "$gt":
+		return order > 0, nil
+	case "$gte":
+		return order >= 0, nil
+	case "$lt":
+		return order < 0, nil
+	case "$lte":
+		return order <= 0, nil
+	}
+	return false, fmt.Errorf("unsupported selector operator %s", operator)
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// testIterator iterates over a fixed list of results
+type testIterator struct {
+	results []*queryresult.KV
+}
+
+func (it *testIterator) HasNext() bool {
+	return len(it.results) > 0
+}
+
+func (it *testIterator) Next() (*queryresult.KV, error) {
+	if len(it.results) == 0 {
+		return nil, errors.New("no more results")
+	}
+	result := it.results[0]
+	it.results = it.results[1:]
+	return result, nil
+}
+
+func (it *testIterator) Close() error {
+	return nil
+}
+
+// testHistoryIterator iterates over a fixed list of key modifications
+type testHistoryIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *testHistoryIterator) HasNext() bool {
+	return len(it.modifications) > 0
+}
+
+func (it *testHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.modifications) == 0 {
+		return nil, errors.New("no more results")
+	}
+	modification := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return modification, nil
+}
+
+func (it *testHistoryIterator) Close() error {
+	return nil
+}
+
+// testCards stands in for the service chaincode: every client holds a card for testServiceID,
+// and services are read from its registry
+type testCards struct {
+	services map[string]*Service
+}
+
+func (c *testCards) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return shim.Success(nil)
+}
+
+func (c *testCards) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function == "ReadService" {
+		service, ok := c.services[args[0]]
+		if !ok {
+			return shim.Error(fmt.Sprintf("the service %s is not registered", args[0]))
+		}
+		serviceBytes, err := json.Marshal(service)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(serviceBytes)
+	}
+	if function == "TokenOfOwnerByService" && args[1] == testServiceID {
+		return shim.Success([]byte("card-" + hashField(args[0])[:8]))
+	}
+	return shim.Error(fmt.Sprintf("%s holds no valid card for service %s", args[0], args[1]))
+}
+
+// testNetwork is the query chaincode on a MockStub, initialized by an admin of testMSPID,
+// which has consented to its own clients querying testTable. testServiceID is a free service
+// provided by testProviderMSPID.
+type testNetwork struct {
+	admin *testClient
+	ca    *testCA
+	cards *testCards
+	stub  *testStub
+	txs   int
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	return newTestNetworkOn(t, false)
+}
+
+// newTestNetworkOn returns a test network whose world state answers CouchDB selector queries if couchDB is set
+func newTestNetworkOn(t *testing.T, couchDB bool) *testNetwork {
+	queryContract := new(QuerySmartContract)
+	queryContract.BeforeTransaction = queryPolicies.BeforeTransaction()
+	creditContract := new(CreditTokenContract)
+	creditContract.Contract.Name = "credit"
+	creditContract.BeforeTransaction = creditPolicies.BeforeTransaction()
+	chaincode, err := contractapi.NewChaincode(queryContract, creditContract)
+	require.NoError(t, err)
+
+	// The clients of the tests read private data through a peer of their own org
+	t.Setenv("CORE_PEER_LOCALMSPID", testMSPID)
+
+	stub := newTestStub("query", chaincode)
+	stub.couchDB = couchDB
+	cards := &testCards{services: map[string]*Service{
+		testServiceID: {ServiceID: testServiceID, ProviderMSPID: testProviderMSPID, Status: "active"},
+	}}
+	stub.MockPeerChaincode(testCardsChaincode, shimtest.NewMockStub(testCardsChaincode, cards), "")
+
+	ca := newTestCA(t)
+	network := &testNetwork{admin: ca.enroll(t, "admin", adminOU, nil), ca: ca, cards: cards, stub: stub}
+
+	stateDatabase := stateDatabaseLevelDB
+	if couchDB {
+		stateDatabase = stateDatabaseCouchDB
+	}
+	network.mustInvoke(t, network.admin, "Initialize", testMSPID, testCardsChaincode, stateDatabase)
+	network.mustInvoke(t, network.admin, "SetMSPRootCertificates", string(ca.certPEM))
+	network.mustInvoke(t, network.admin, "SetTableOwner", hashField(testTable), testMSPID)
+	network.mustInvoke(t, network.admin, "GrantConsent", hashField(testTable), testMSPID, "research", "0", "0")
+	return network
+}
+
+// invoke submits a transaction as the client and returns its payload, or its error message as an error
+func (n *testNetwork) invoke(t *testing.T, client *testClient, function string, args ...string) ([]byte, error) {
+	return n.invokeWithTransient(t, client, nil, function, args...)
+}
+
+func (n *testNetwork) invokeWithTransient(t *testing.T, client *testClient, transient map[string][]byte, function string, args ...string) ([]byte, error) {
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: client.mspID, IdBytes: client.certPEM})
+	require.NoError(t, err)
+	n.stub.Creator = creator
+	n.stub.TransientMap = transient
+
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	n.txs++
+	response := n.stub.invoke(fmt.Sprintf("tx%d", n.txs), invokeArgs)
+	if response.Status != shim.OK {
+		return nil, errors.New(response.Message)
+	}
+	return response.Payload, nil
+}
+
+func (n *testNetwork) mustInvoke(t *testing.T, client *testClient, function string, args ...string) []byte {
+	payload, err := n.invoke(t, client, function, args...)
+	require.NoError(t, err, "%s(%v)", function, args)
+	return payload
+}
+
+// createQuery logs a query of the client against testServiceID
+func (n *testNetwork) createQuery(t *testing.T, client *testClient, queryID string, dataRows int) error {
+	return n.createQueryWithDetails(t, client, client.details(t, queryID, "SELECT * FROM "+testTable), dataRows)
+}
+
+// createQueryWithDetails logs a query of the client against testServiceID with the given private details
+func (n *testNetwork) createQueryWithDetails(t *testing.T, client *testClient, details *QueryPrivateDetails, dataRows int) error {
+	detailsBytes, err := json.Marshal(details)
+	require.NoError(t, err)
+
+	_, err = n.invokeWithTransient(t, client, map[string][]byte{transientQueryKey: detailsBytes},
+		"CreateQuery", testDataDigest, fmt.Sprint(dataRows), "0", details.QueryID, testServiceID)
+	return err
+}
+
+// readQuery reads a query straight from the ledger of the network
+func (n *testNetwork) readQuery(t *testing.T, queryID string) *Query {
+	key, err := n.stub.CreateCompositeKey(queryPrefix, []string{queryID})
+	require.NoError(t, err)
+
+	queryBytes := n.stub.State[key]
+	if queryBytes == nil {
+		return nil
+	}
+
+	var query Query
+	require.NoError(t, json.Unmarshal(queryBytes, &query))
+	return &query
+}
+
+// testDataDigest is the DataDigest of the queries of the tests
+var testDataDigest = hex.EncodeToString(make([]byte, sha256.Size))
+
+func TestCreateQuery(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+
+	query := network.readQuery(t, "query1")
+	require.NotNil(t, query)
+	require.Equal(t, user.id(t), query.InitiatorID)
+	require.Equal(t, testMSPID, query.InitiatorMSPID)
+	require.Equal(t, legitimacyPending, query.Legitimacy)
+	require.Equal(t, 1, query.Sequence)
+
+	require.EqualError(t, network.createQuery(t, user, "query1", 3), "the query query1 already exists")
+}
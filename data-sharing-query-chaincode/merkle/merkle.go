@@ -0,0 +1,182 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package merkle computes the DataDigest of a query as the Merkle root over the SQL result rows
+// and produces and verifies proofs that a single row is part of a result.
+//
+// Rows are canonically encoded (see EncodeRow) and hashed into a tree as in RFC 6962:
+// leaves are SHA-256(0x00 || row) and nodes are SHA-256(0x01 || left || right), with the
+// left subtree of n leaves holding the largest power of two smaller than n.
+// The service client and the chaincode must use this package so that digests match.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+const leafPrefix = 0x00
+const nodePrefix = 0x01
+
+// Proof is an inclusion proof of the row at Index in a result of Size rows.
+// Siblings are the hex encoded hashes of the audit path, from the leaf up to the root.
+type Proof struct {
+	Index    int      `json:"Index"`
+	Siblings []string `json:"Siblings"`
+	Size     int      `json:"Size"`
+}
+
+// EncodeRow returns the canonical encoding of a row: the number of columns followed by
+// every column value, each prefixed by its length, all as unsigned varints.
+func EncodeRow(row []string) []byte {
+	var buf bytes.Buffer
+	varint := make([]byte, binary.MaxVarintLen64)
+
+	n := binary.PutUvarint(varint, uint64(len(row)))
+	buf.Write(varint[:n])
+	for _, column := range row {
+		n = binary.PutUvarint(varint, uint64(len(column)))
+		buf.Write(varint[:n])
+		buf.WriteString(column)
+	}
+
+	return buf.Bytes()
+}
+
+// LeafHash returns the hash of a row as a leaf of the tree
+func LeafHash(row []string) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(EncodeRow(row))
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Root returns the Merkle root over rows. The root of an empty result is SHA-256 of nothing.
+func Root(rows [][]string) []byte {
+	if len(rows) == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+
+	leaves := make([][]byte, len(rows))
+	for i, row := range rows {
+		leaves[i] = LeafHash(row)
+	}
+
+	return rootOf(leaves)
+}
+
+// RootHex returns the hex encoded Merkle root over rows, as stored in Query.DataDigest
+func RootHex(rows [][]string) string {
+	return hex.EncodeToString(Root(rows))
+}
+
+// Prove returns the inclusion proof of the row at index
+func Prove(rows [][]string, index int) (*Proof, error) {
+	if index < 0 || index >= len(rows) {
+		return nil, fmt.Errorf("row index %d out of range [0, %d)", index, len(rows))
+	}
+
+	leaves := make([][]byte, len(rows))
+	for i, row := range rows {
+		leaves[i] = LeafHash(row)
+	}
+
+	var siblings []string
+	for _, sibling := range pathOf(index, leaves) {
+		siblings = append(siblings, hex.EncodeToString(sibling))
+	}
+	if siblings == nil {
+		siblings = []string{}
+	}
+
+	return &Proof{
+		Index:    index,
+		Siblings: siblings,
+		Size:     len(rows),
+	}, nil
+}
+
+// Verify checks that row is included at proof.Index in the result whose Merkle root is root
+func Verify(root []byte, row []string, proof *Proof) error {
+	if proof.Size <= 0 || proof.Index < 0 || proof.Index >= proof.Size {
+		return fmt.Errorf("row index %d out of range [0, %d)", proof.Index, proof.Size)
+	}
+
+	index := proof.Index
+	last := proof.Size - 1
+	hash := LeafHash(row)
+	for _, siblingHex := range proof.Siblings {
+		sibling, err := hex.DecodeString(siblingHex)
+		if err != nil {
+			return fmt.Errorf("failed to decode sibling %s: %v", siblingHex, err)
+		}
+		if last == 0 {
+			return fmt.Errorf("proof has more siblings than the tree has levels")
+		}
+
+		if index%2 == 1 || index == last {
+			hash = nodeHash(sibling, hash)
+			// A right-most node without a sibling at this level is promoted as is
+			for index%2 == 0 && index != 0 {
+				index >>= 1
+				last >>= 1
+			}
+		} else {
+			hash = nodeHash(hash, sibling)
+		}
+		index >>= 1
+		last >>= 1
+	}
+
+	if last != 0 {
+		return fmt.Errorf("proof has fewer siblings than the tree has levels")
+	}
+	if !bytes.Equal(hash, root) {
+		return fmt.Errorf("row is not included in the result")
+	}
+
+	return nil
+}
+
+// splitPoint returns the largest power of two smaller than n, for n > 1
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func rootOf(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+
+	k := splitPoint(len(leaves))
+	return nodeHash(rootOf(leaves[:k]), rootOf(leaves[k:]))
+}
+
+func pathOf(index int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+
+	k := splitPoint(len(leaves))
+	if index < k {
+		return append(pathOf(index, leaves[:k]), rootOf(leaves[k:]))
+	}
+	return append(pathOf(index-k, leaves[k:]), rootOf(leaves[:k]))
+}
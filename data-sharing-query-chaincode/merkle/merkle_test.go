@@ -0,0 +1,151 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func makeRows(n int) [][]string {
+	rows := make([][]string, n)
+	for i := range rows {
+		rows[i] = []string{fmt.Sprintf("row%d", i), fmt.Sprintf("%d", i*i)}
+	}
+	return rows
+}
+
+func TestRoot(t *testing.T) {
+	rows := makeRows(7)
+	l := make([][]byte, len(rows))
+	for i, row := range rows {
+		l[i] = LeafHash(row)
+	}
+	empty := sha256.Sum256(nil)
+
+	tests := []struct {
+		name string
+		rows [][]string
+		want []byte
+	}{
+		{"empty", nil, empty[:]},
+		{"single leaf", rows[:1], l[0]},
+		{"two leaves", rows[:2], nodeHash(l[0], l[1])},
+		{"three leaves", rows[:3], nodeHash(nodeHash(l[0], l[1]), l[2])},
+		{"five leaves", rows[:5], nodeHash(nodeHash(nodeHash(l[0], l[1]), nodeHash(l[2], l[3])), l[4])},
+		{"seven leaves", rows[:7], nodeHash(nodeHash(nodeHash(l[0], l[1]), nodeHash(l[2], l[3])), nodeHash(nodeHash(l[4], l[5]), l[6]))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Root(tt.rows); !bytes.Equal(got, tt.want) {
+				t.Errorf("Root() = %x, want %x", got, tt.want)
+			}
+			if got := RootHex(tt.rows); got != hex.EncodeToString(tt.want) {
+				t.Errorf("RootHex() = %s, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeRowIsUnambiguous(t *testing.T) {
+	if bytes.Equal(LeafHash([]string{"ab", "c"}), LeafHash([]string{"a", "bc"})) {
+		t.Error("rows with the same concatenation have the same leaf hash")
+	}
+	if bytes.Equal(LeafHash([]string{""}), LeafHash([]string{})) {
+		t.Error("a row with one empty column has the same leaf hash as an empty row")
+	}
+}
+
+func TestProveAndVerify(t *testing.T) {
+	for _, size := range []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 13, 16, 17} {
+		rows := makeRows(size)
+		root := Root(rows)
+		for index := range rows {
+			t.Run(fmt.Sprintf("size %d index %d", size, index), func(t *testing.T) {
+				proof, err := Prove(rows, index)
+				if err != nil {
+					t.Fatalf("Prove() error = %v", err)
+				}
+				if size == 1 && len(proof.Siblings) != 0 {
+					t.Errorf("proof of a single leaf has %d siblings, want none", len(proof.Siblings))
+				}
+				if err := Verify(root, rows[index], proof); err != nil {
+					t.Errorf("Verify() error = %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestProveOutOfRange(t *testing.T) {
+	rows := makeRows(3)
+	for _, index := range []int{-1, 3} {
+		if _, err := Prove(rows, index); err == nil {
+			t.Errorf("Prove(%d) succeeded, want an error", index)
+		}
+	}
+	if _, err := Prove(nil, 0); err == nil {
+		t.Error("Prove() on an empty result succeeded, want an error")
+	}
+}
+
+func TestVerifyTamperedProof(t *testing.T) {
+	rows := makeRows(5)
+	root := Root(rows)
+
+	flip := func(siblingHex string) string {
+		sibling, _ := hex.DecodeString(siblingHex)
+		sibling[0] ^= 0xff
+		return hex.EncodeToString(sibling)
+	}
+
+	tests := []struct {
+		name   string
+		row    []string
+		tamper func(p *Proof)
+	}{
+		{"other row", rows[3], func(p *Proof) {}},
+		{"modified row", []string{"row2", "5"}, func(p *Proof) {}},
+		{"modified first sibling", rows[2], func(p *Proof) { p.Siblings[0] = flip(p.Siblings[0]) }},
+		{"modified last sibling", rows[2], func(p *Proof) { p.Siblings[len(p.Siblings)-1] = flip(p.Siblings[len(p.Siblings)-1]) }},
+		{"swapped siblings", rows[2], func(p *Proof) { p.Siblings[0], p.Siblings[1] = p.Siblings[1], p.Siblings[0] }},
+		{"other index", rows[2], func(p *Proof) { p.Index = 3 }},
+		{"negative index", rows[2], func(p *Proof) { p.Index = -1 }},
+		{"index beyond size", rows[2], func(p *Proof) { p.Index = 5 }},
+		{"other size", rows[2], func(p *Proof) { p.Size = 4 }},
+		{"zero size", rows[2], func(p *Proof) { p.Size = 0 }},
+		{"missing sibling", rows[2], func(p *Proof) { p.Siblings = p.Siblings[:len(p.Siblings)-1] }},
+		{"extra sibling", rows[2], func(p *Proof) { p.Siblings = append(p.Siblings, p.Siblings[0]) }},
+		{"malformed sibling", rows[2], func(p *Proof) { p.Siblings[0] = "not hex" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := Prove(rows, 2)
+			if err != nil {
+				t.Fatalf("Prove() error = %v", err)
+			}
+			tt.tamper(proof)
+			if err := Verify(root, tt.row, proof); err == nil {
+				t.Error("Verify() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestVerifySingleLeafAgainstOtherRoot(t *testing.T) {
+	rows := makeRows(1)
+	proof, err := Prove(rows, 0)
+	if err != nil {
+		t.Fatalf("Prove() error = %v", err)
+	}
+	if err := Verify(Root(makeRows(2)), rows[0], proof); err == nil {
+		t.Error("Verify() succeeded against the root of another result, want an error")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// transientQueriesKey is the transient map key carrying the private details of a batch of queries
+const transientQueriesKey = "queries_properties"
+
+// QueryBatchItem is one query of a CreateQueries batch. Without an initiator the submitting
+// client is the initiator; otherwise the initiator must have delegated to the submitting client.
+type QueryBatchItem struct {
+	DataDigest     string  `json:"DataDigest"`
+	DataRows       int     `json:"DataRows"`
+	Epsilon        float64 `json:"Epsilon" metadata:",optional"`
+	InitiatorID    string  `json:"InitiatorID" metadata:",optional"`
+	InitiatorMSPID string  `json:"InitiatorMSPID" metadata:",optional"`
+	QueryID        string  `json:"QueryID"`
+	ServiceID      string  `json:"ServiceID"`
+}
+
+// QueryBatchItemResult reports the outcome of one query of a batch. Error is empty for a valid query.
+type QueryBatchItemResult struct {
+	Error    string `json:"Error"`
+	Index    int    `json:"Index"`
+	QueryID  string `json:"QueryID"`
+	Sequence int    `json:"Sequence"`
+}
+
+// QueryBatchResult reports the outcome of CreateQueries.
+// The batch is only written when every query is valid, in which case Committed is true.
+type QueryBatchResult struct {
+	Committed bool                    `json:"Committed"`
+	Failed    int                     `json:"Failed"`
+	Items     []*QueryBatchItemResult `json:"Items"`
+}
+
+// CreateQueries issues a batch of queries in a single transaction, checking each like CreateQuery
+// (or CreateQueryOnBehalfOf for items naming another initiator). Later queries see the effects of
+// earlier ones on quotas and hash chains. The private details are passed in the transient map under
+// "queries_properties" as a JSON array matched to the queries by QueryID.
+// If any query is invalid nothing is written and the errors are reported per item.
+// Otherwise one QueryBatch event carries all the created queries.
+func (s *QuerySmartContract) CreateQueries(ctx contractapi.TransactionContextInterface, queries []QueryBatchItem) (*QueryBatchResult, error) {
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("the batch holds no queries")
+	}
+
+	detailsByID, err := getQueriesTransientInput(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	submitterID, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	submitterMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+
+	batch := newStateOverlay(ctx.GetStub())
+	result := &QueryBatchResult{Items: []*QueryBatchItemResult{}}
+	var created []*Query
+	for i, item := range queries {
+		// Every query runs on its own overlay so that an invalid one leaves no trace for the next
+		itemStub := newStateOverlay(batch)
+		itemCtx := new(contractapi.TransactionContext)
+		itemCtx.SetStub(itemStub)
+		itemCtx.SetClientIdentity(ctx.GetClientIdentity())
+
+		query := &Query{
+			DataDigest:     item.DataDigest,
+			DataRows:       item.DataRows,
+			Epsilon:        item.Epsilon,
+			InitiatorID:    item.InitiatorID,
+			InitiatorMSPID: item.InitiatorMSPID,
+			QueryID:        item.QueryID,
+			ServiceID:      item.ServiceID,
+			SubmitterID:    submitterID,
+			SubmitterMSPID: submitterMSPID,
+		}
+		err = s.putBatchQuery(itemCtx, query, detailsByID[item.QueryID])
+
+		itemResult := &QueryBatchItemResult{Index: i, QueryID: item.QueryID}
+		if err != nil {
+			itemResult.Error = err.Error()
+			result.Failed++
+		} else {
+			itemResult.Sequence = query.Sequence
+			created = append(created, query)
+			err = itemStub.flush()
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.Items = append(result.Items, itemResult)
+	}
+
+	if result.Failed > 0 {
+		return result, nil
+	}
+
+	err = batch.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	createdBytes, err := json.Marshal(created)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ctx.GetStub().SetEvent("QueryBatch", createdBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to SetEvent QueryBatch: %v", err)
+	}
+
+	result.Committed = true
+	return result, nil
+}
+
+// putBatchQuery checks the initiator and private details of one query of a batch and puts it
+func (s *QuerySmartContract) putBatchQuery(ctx contractapi.TransactionContextInterface, query *Query, details *QueryPrivateDetails) error {
+	if details == nil {
+		return fmt.Errorf("no private details for query %s in %s", query.QueryID, transientQueriesKey)
+	}
+
+	err := validateQueryPrivateDetails(details)
+	if err != nil {
+		return err
+	}
+
+	if query.InitiatorID == "" && query.InitiatorMSPID == "" {
+		query.InitiatorID = query.SubmitterID
+		query.InitiatorMSPID = query.SubmitterMSPID
+	} else if query.InitiatorID != query.SubmitterID || query.InitiatorMSPID != query.SubmitterMSPID {
+		err = delegatePolicy.Check("CreateQueries", ctx.GetClientIdentity())
+		if err != nil {
+			return err
+		}
+
+		err = s.checkDelegation(ctx, query.InitiatorMSPID, query.InitiatorID, query.SubmitterMSPID, query.SubmitterID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.putQuery(ctx, query, details)
+}
+
+// getQueriesTransientInput reads the private details of a batch of queries from the transient map
+func getQueriesTransientInput(ctx contractapi.TransactionContextInterface) (map[string]*QueryPrivateDetails, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+
+	transientQueriesJSON, ok := transientMap[transientQueriesKey]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in the transient map input", transientQueriesKey)
+	}
+
+	var detailsList []*QueryPrivateDetails
+	err = json.Unmarshal(transientQueriesJSON, &detailsList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	detailsByID := make(map[string]*QueryPrivateDetails)
+	for _, details := range detailsList {
+		detailsByID[details.QueryID] = details
+	}
+
+	return detailsByID, nil
+}
+
+// overlayValue is a buffered write. A deleted key has no value.
+type overlayValue struct {
+	deleted bool
+	value   []byte
+}
+
+// stateOverlay buffers the writes of a stub so that they can be read back before they are
+// committed (a stub only returns the state as of the start of the transaction) and dropped
+// if they turn out to be invalid. Events are dropped as well. flush applies the writes to
+// the underlying stub, which may itself be an overlay.
+type stateOverlay struct {
+	shim.ChaincodeStubInterface
+	keys         []string
+	state        map[string]overlayValue
+	privateKeys  [][2]string
+	privateState map[[2]string]overlayValue
+}
+
+func newStateOverlay(stub shim.ChaincodeStubInterface) *stateOverlay {
+	return &stateOverlay{
+		ChaincodeStubInterface: stub,
+		state:                  make(map[string]overlayValue),
+		privateState:           make(map[[2]string]overlayValue),
+	}
+}
+
+func (o *stateOverlay) GetState(key string) ([]byte, error) {
+	if v, ok := o.state[key]; ok {
+		return v.value, nil
+	}
+	return o.ChaincodeStubInterface.GetState(key)
+}
+
+func (o *stateOverlay) PutState(key string, value []byte) error {
+	return o.write(key, overlayValue{value: value})
+}
+
+func (o *stateOverlay) DelState(key string) error {
+	return o.write(key, overlayValue{deleted: true})
+}
+
+func (o *stateOverlay) write(key string, v overlayValue) error {
+	if _, ok := o.state[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.state[key] = v
+	return nil
+}
+
+func (o *stateOverlay) GetPrivateData(collection string, key string) ([]byte, error) {
+	if v, ok := o.privateState[[2]string{collection, key}]; ok {
+		return v.value, nil
+	}
+	return o.ChaincodeStubInterface.GetPrivateData(collection, key)
+}
+
+func (o *stateOverlay) PutPrivateData(collection string, key string, value []byte) error {
+	return o.writePrivate(collection, key, overlayValue{value: value})
+}
+
+func (o *stateOverlay) DelPrivateData(collection string, key string) error {
+	return o.writePrivate(collection, key, overlayValue{deleted: true})
+}
+
+func (o *stateOverlay) writePrivate(collection string, key string, v overlayValue) error {
+	privateKey := [2]string{collection, key}
+	if _, ok := o.privateState[privateKey]; !ok {
+		o.privateKeys = append(o.privateKeys, privateKey)
+	}
+	o.privateState[privateKey] = v
+	return nil
+}
+
+func (o *stateOverlay) SetEvent(name string, payload []byte) error {
+	return nil
+}
+
+// flush applies the buffered writes to the underlying stub in the order they were first made
+func (o *stateOverlay) flush() error {
+	var err error
+	for _, key := range o.keys {
+		v := o.state[key]
+		if v.deleted {
+			err = o.ChaincodeStubInterface.DelState(key)
+		} else {
+			err = o.ChaincodeStubInterface.PutState(key, v.value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %v", key, err)
+		}
+	}
+
+	for _, privateKey := range o.privateKeys {
+		v := o.privateState[privateKey]
+		if v.deleted {
+			err = o.ChaincodeStubInterface.DelPrivateData(privateKey[0], privateKey[1])
+		} else {
+			err = o.ChaincodeStubInterface.PutPrivateData(privateKey[0], privateKey[1], v.value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s to collection %s: %v", privateKey[1], privateKey[0], err)
+		}
+	}
+
+	return nil
+}
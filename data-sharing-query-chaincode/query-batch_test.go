@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateOverlayReadYourWrites(t *testing.T) {
+	_, stub := newTestContext()
+	require.NoError(t, stub.PutState("a", []byte("1")))
+	require.NoError(t, stub.PutPrivateData("collection", "p", []byte("1")))
+	stub.MockTransactionEnd("tx1")
+	stub.MockTransactionStart("tx2")
+
+	batch := newStateOverlay(stub)
+	require.NoError(t, batch.PutState("b", []byte("2")))
+	require.NoError(t, batch.DelState("a"))
+	require.NoError(t, batch.PutPrivateData("collection", "q", []byte("2")))
+	require.NoError(t, batch.SetEvent("Query", []byte("event")))
+
+	value, err := batch.GetState("b")
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), value)
+	value, err = batch.GetState("a")
+	require.NoError(t, err)
+	require.Nil(t, value)
+	value, err = batch.GetPrivateData("collection", "q")
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), value)
+
+	// An overlay on an overlay reads the writes of both, and only passes its own on when flushed
+	item := newStateOverlay(batch)
+	require.NoError(t, item.PutState("c", []byte("3")))
+	value, err = item.GetState("b")
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), value)
+	value, err = batch.GetState("c")
+	require.NoError(t, err)
+	require.Nil(t, value)
+
+	require.NoError(t, item.flush())
+	value, err = batch.GetState("c")
+	require.NoError(t, err)
+	require.Equal(t, []byte("3"), value)
+
+	// Nothing reaches the stub before the batch is flushed
+	require.Equal(t, []byte("1"), stub.State["a"])
+	require.Nil(t, stub.State["b"])
+	require.Nil(t, stub.State["c"])
+	require.Equal(t, []byte("1"), stub.PvtState["collection"]["p"])
+
+	require.NoError(t, batch.flush())
+	require.Nil(t, stub.State["a"])
+	require.Equal(t, []byte("2"), stub.State["b"])
+	require.Equal(t, []byte("3"), stub.State["c"])
+	require.Equal(t, []byte("1"), stub.PvtState["collection"]["p"])
+	require.Equal(t, []byte("2"), stub.PvtState["collection"]["q"])
+	require.Empty(t, stub.ChaincodeEventsChannel)
+
+	// Private data deletes are read back the same way
+	other := newStateOverlay(stub)
+	require.NoError(t, other.DelPrivateData("collection", "p"))
+	value, err = other.GetPrivateData("collection", "p")
+	require.NoError(t, err)
+	require.Nil(t, value)
+}
+
+// createQueries submits a batch of queries of the client against testServiceID
+func (n *testNetwork) createQueries(t *testing.T, client *testClient, items []QueryBatchItem) *QueryBatchResult {
+	var detailsList []*QueryPrivateDetails
+	for _, item := range items {
+		detailsList = append(detailsList, client.details(t, item.QueryID, "SELECT * FROM "+testTable))
+	}
+	detailsBytes, err := json.Marshal(detailsList)
+	require.NoError(t, err)
+	itemsBytes, err := json.Marshal(items)
+	require.NoError(t, err)
+
+	payload, err := n.invokeWithTransient(t, client, map[string][]byte{transientQueriesKey: detailsBytes}, "CreateQueries", string(itemsBytes))
+	require.NoError(t, err)
+
+	var result QueryBatchResult
+	require.NoError(t, json.Unmarshal(payload, &result))
+	return &result
+}
+
+func batchItem(queryID string, serviceID string) QueryBatchItem {
+	return QueryBatchItem{DataDigest: testDataDigest, DataRows: 1, QueryID: queryID, ServiceID: serviceID}
+}
+
+// stateKeys lists every key of the world state and the private data of the network
+func (n *testNetwork) stateKeys() []string {
+	var keys []string
+	for key := range n.stub.State {
+		keys = append(keys, key)
+	}
+	for collection, state := range n.stub.PvtState {
+		for key := range state {
+			keys = append(keys, collection+"/"+key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCreateQueriesLinksEachQueryToTheOneBefore(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	result := network.createQueries(t, user, []QueryBatchItem{batchItem("query1", testServiceID), batchItem("query2", testServiceID)})
+	require.True(t, result.Committed)
+	require.Equal(t, 0, result.Failed)
+	require.Equal(t, 1, result.Items[0].Sequence)
+	require.Equal(t, 2, result.Items[1].Sequence)
+
+	// The second query read the chain head and sequence index written by the first
+	head := new(QueryChainHead)
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, user, "GetQueryChainHead", testServiceID), head))
+	require.Equal(t, "query2", head.LastQueryID)
+	require.Equal(t, 2, head.Sequence)
+
+	report := new(QueryChainReport)
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, user, "VerifyQueryChain", testServiceID, "1", "2"), report))
+	require.True(t, report.Valid, "issues: %+v", report.Issues)
+}
+
+func TestCreateQueriesSeesItsOwnQuotaUsage(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	network.mustInvoke(t, network.admin, "SetQuota", testMSPID, testServiceID, "1", "0")
+
+	before := network.stateKeys()
+	result := network.createQueries(t, user, []QueryBatchItem{batchItem("query1", testServiceID), batchItem("query2", testServiceID)})
+	require.False(t, result.Committed)
+	require.Equal(t, 1, result.Failed)
+	require.Equal(t, "", result.Items[0].Error)
+	require.Contains(t, result.Items[1].Error, "quota of 1 queries per day")
+	require.Equal(t, before, network.stateKeys())
+}
+
+func TestCreateQueriesDuplicateQueryIDs(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	before := network.stateKeys()
+	result := network.createQueries(t, user, []QueryBatchItem{batchItem("query1", testServiceID), batchItem("query1", testServiceID)})
+	require.False(t, result.Committed)
+	require.Equal(t, 1, result.Failed)
+	require.Equal(t, "", result.Items[0].Error)
+	require.Equal(t, "the query query1 already exists", result.Items[1].Error)
+	require.Equal(t, before, network.stateKeys())
+	require.Nil(t, network.readQuery(t, "query1"))
+}
+
+func TestCreateQueriesFailureLeavesNoPartialWrites(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	before := network.stateKeys()
+	result := network.createQueries(t, user, []QueryBatchItem{
+		batchItem("query1", testServiceID),
+		batchItem("query2", "service2"),
+		batchItem("query3", testServiceID),
+	})
+	require.False(t, result.Committed)
+	require.Equal(t, 1, result.Failed)
+	require.Equal(t, "", result.Items[0].Error)
+	require.Contains(t, result.Items[1].Error, "holds no card for service service2")
+	require.Equal(t, "", result.Items[2].Error)
+
+	// The valid queries around the invalid one are not written either
+	require.Equal(t, before, network.stateKeys())
+	require.Nil(t, network.readQuery(t, "query1"))
+	require.Nil(t, network.readQuery(t, "query3"))
+	_, err := network.invoke(t, user, "GetQueryChainHead", testServiceID)
+	require.EqualError(t, err, "no query has been issued against service "+testServiceID)
+
+	// The same batch without the invalid query goes through
+	result = network.createQueries(t, user, []QueryBatchItem{batchItem("query1", testServiceID), batchItem("query3", testServiceID)})
+	require.True(t, result.Committed)
+	require.NotNil(t, network.readQuery(t, "query1"))
+	require.NotNil(t, network.readQuery(t, "query3"))
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// Define objectType name for the MSP root certificates that query certificates must chain to
+const mspRootsPrefix = "mspRoots"
+
+// MSP admins carry this organizational unit in their certificate
+const adminOU = "admin"
+
+// MSPRootCertificates are the PEM encoded root (and intermediate) CA certificates of an MSP
+type MSPRootCertificates struct {
+	MSPID            string `json:"MSPID"`
+	RootCertificates string `json:"RootCertificates"`
+	UpdatedAt        int    `json:"UpdatedAt"`
+}
+
+// SetMSPRootCertificates registers the CA certificates of the submitting client's MSP.
+// Only an admin of that MSP may call it.
+func (s *QuerySmartContract) SetMSPRootCertificates(ctx contractapi.TransactionContextInterface, rootCertificates string) (*MSPRootCertificates, error) {
+	isAdmin, err := cid.HasOUValue(ctx.GetStub(), adminOU)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check client organizational unit: %v", err)
+	}
+	if !isAdmin {
+		return nil, fmt.Errorf("submitting client is not an MSP admin")
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+
+	certs, err := parseCertificates(rootCertificates)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		if !cert.IsCA {
+			return nil, fmt.Errorf("certificate %s is not a CA certificate", cert.Subject)
+		}
+	}
+
+	timestamp, err := getTxTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := &MSPRootCertificates{
+		MSPID:            mspID,
+		RootCertificates: rootCertificates,
+		UpdatedAt:        timestamp,
+	}
+	rootsBytes, err := json.Marshal(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	rootsKey, err := ctx.GetStub().CreateCompositeKey(mspRootsPrefix, []string{mspID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", mspRootsPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(rootsKey, rootsBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to PutState %s: %v", rootsKey, err)
+	}
+
+	return roots, nil
+}
+
+// ReadMSPRootCertificates returns the registered CA certificates of an MSP
+func (s *QuerySmartContract) ReadMSPRootCertificates(ctx contractapi.TransactionContextInterface, mspID string) (*MSPRootCertificates, error) {
+	rootsKey, err := ctx.GetStub().CreateCompositeKey(mspRootsPrefix, []string{mspID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", mspRootsPrefix, err)
+	}
+
+	rootsBytes, err := ctx.GetStub().GetState(rootsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if rootsBytes == nil {
+		return nil, fmt.Errorf("no root certificates are registered for MSP %s", mspID)
+	}
+
+	var roots MSPRootCertificates
+	err = json.Unmarshal(rootsBytes, &roots)
+	if err != nil {
+		return nil, err
+	}
+
+	return &roots, nil
+}
+
+// verifyQuerySignature checks that the certificate of a query chains to the initiator's MSP,
+// belongs to the initiator, and signed the query digest
+func (s *QuerySmartContract) verifyQuerySignature(ctx contractapi.TransactionContextInterface, query *Query, details *QueryPrivateDetails) error {
+	certs, err := parseCertificates(details.Certificate)
+	if err != nil {
+		return err
+	}
+	cert := certs[0]
+
+	roots, err := s.ReadMSPRootCertificates(ctx, query.InitiatorMSPID)
+	if err != nil {
+		return err
+	}
+	rootCerts, err := parseCertificates(roots.RootCertificates)
+	if err != nil {
+		return err
+	}
+
+	// Verify at the transaction time so that every endorser reaches the same result
+	timestamp, err := getTxTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	for _, rootCert := range rootCerts {
+		pool.AddCert(rootCert)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:       pool,
+		CurrentTime: time.Unix(int64(timestamp), 0),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("the certificate does not chain to MSP %s: %v", query.InitiatorMSPID, err)
+	}
+
+	signerID, err := certificateIdentity(query.InitiatorMSPID, details.Certificate)
+	if err != nil {
+		return err
+	}
+	if signerID != query.InitiatorID {
+		return fmt.Errorf("the certificate belongs to %s, not to the initiator %s", signerID, query.InitiatorID)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(details.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+
+	var algorithm x509.SignatureAlgorithm
+	switch cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		algorithm = x509.ECDSAWithSHA256
+	case *rsa.PublicKey:
+		algorithm = x509.SHA256WithRSA
+	case ed25519.PublicKey:
+		algorithm = x509.PureEd25519
+	default:
+		return fmt.Errorf("unsupported public key type %T", cert.PublicKey)
+	}
+
+	err = cert.CheckSignature(algorithm, []byte(details.QueryDigest), signature)
+	if err != nil {
+		return fmt.Errorf("the signature over the query digest is invalid: %v", err)
+	}
+
+	return nil
+}
+
+// parseCertificates decodes every certificate of a PEM bundle
+func parseCertificates(certificatesPEM string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(certificatesPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+
+	return certs, nil
+}
+
+// certificateIdentity returns the identity a certificate would have as a submitting client,
+// in the same format as getClientIdentity
+func certificateIdentity(mspID string, certificatePEM string) (string, error) {
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: []byte(certificatePEM)})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal identity: %v", err)
+	}
+
+	id64, err := cid.GetID(creatorStub(creator))
+	if err != nil {
+		return "", fmt.Errorf("failed to get certificate identity: %v", err)
+	}
+
+	idBytes, err := base64.StdEncoding.DecodeString(id64)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode certificate identity: %v", err)
+	}
+
+	return strings.ReplaceAll(string(idBytes), " ", ""), nil
+}
+
+// creatorStub presents a serialized identity to the cid package
+type creatorStub []byte
+
+func (c creatorStub) GetCreator() ([]byte, error) {
+	return c, nil
+}
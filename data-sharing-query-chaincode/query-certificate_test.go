@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMSPRootCertificates(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	_, err := network.invoke(t, user, "SetMSPRootCertificates", string(network.ca.certPEM))
+	require.EqualError(t, err, "submitting client is not an MSP admin")
+	_, err = network.invoke(t, network.admin, "SetMSPRootCertificates", string(user.certPEM))
+	require.ErrorContains(t, err, "is not a CA certificate")
+	_, err = network.invoke(t, network.admin, "SetMSPRootCertificates", "not a certificate")
+	require.EqualError(t, err, "no PEM encoded certificate found")
+
+	_, err = network.invoke(t, user, "ReadMSPRootCertificates", "Org2MSP")
+	require.EqualError(t, err, "no root certificates are registered for MSP Org2MSP")
+}
+
+func TestCreateQueryVerifiesCertificate(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	other := network.ca.enroll(t, "user2", "client", nil)
+	stranger := newTestCA(t).enroll(t, "user1", "client", nil)
+
+	// Another client's certificate and signature do not make a query of the submitter
+	details := other.details(t, "query1", "SELECT * FROM "+testTable)
+	err := network.createQueryWithDetails(t, user, details, 3)
+	require.EqualError(t, err, fmt.Sprintf("the certificate belongs to %s, not to the initiator %s", other.id(t), user.id(t)))
+
+	// A certificate issued outside the MSP does not chain to its registered roots
+	details = user.details(t, "query1", "SELECT * FROM "+testTable)
+	details.Certificate = string(stranger.certPEM)
+	err = network.createQueryWithDetails(t, user, details, 3)
+	require.ErrorContains(t, err, "the certificate does not chain to MSP Org1MSP")
+
+	// The signature must be over the query digest that is recorded
+	details = user.details(t, "query1", "SELECT * FROM "+testTable)
+	details.QueryDigest = "SELECT name FROM " + testTable
+	err = network.createQueryWithDetails(t, user, details, 3)
+	require.ErrorContains(t, err, "the signature over the query digest is invalid")
+
+	details = user.details(t, "query1", "SELECT * FROM "+testTable)
+	details.Signature = "not base64"
+	err = network.createQueryWithDetails(t, user, details, 3)
+	require.ErrorContains(t, err, "failed to decode signature")
+
+	require.NoError(t, network.createQueryWithDetails(t, user, user.details(t, "query1", "SELECT * FROM "+testTable), 3))
+}
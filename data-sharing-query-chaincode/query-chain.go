@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType name for the head of the hash chain of each service
+const chainPrefix = "chain"
+
+// QueryChainHead is the last link of the hash chain of the queries of a service
+type QueryChainHead struct {
+	LastHash    string `json:"LastHash"`
+	LastQueryID string `json:"LastQueryID"`
+	Sequence    int    `json:"Sequence"`
+	ServiceID   string `json:"ServiceID"`
+}
+
+// QueryChainIssue describes a break in the hash chain found by VerifyQueryChain
+type QueryChainIssue struct {
+	QueryID  string `json:"QueryID"`
+	Reason   string `json:"Reason"`
+	Sequence int    `json:"Sequence"`
+}
+
+// QueryChainReport is the result of verifying a range of the hash chain of a service
+type QueryChainReport struct {
+	From      int                `json:"From"`
+	Issues    []*QueryChainIssue `json:"Issues"`
+	ServiceID string             `json:"ServiceID"`
+	To        int                `json:"To"`
+	Valid     bool               `json:"Valid"`
+}
+
+// QueryChainLink is the entry of a query in the sequence index. It keeps the record of the query
+// as it was linked into the chain, encoded so that CouchDB selectors on query fields never match it.
+type QueryChainLink struct {
+	Hash        string `json:"Hash"`
+	RecordBytes []byte `json:"RecordBytes"`
+}
+
+// queryRecordHash returns the hash that the next query of the same service links to.
+// It is taken over the exact bytes of the record as it was created, which the sequence index
+// keeps, so that reviews or later additions to Query do not change it.
+func queryRecordHash(recordBytes []byte) string {
+	hash := sha256.Sum256(recordBytes)
+	return hex.EncodeToString(hash[:])
+}
+
+// linkQuery gives a new query the next sequence number of its service and the hash of the previous query
+func linkQuery(ctx contractapi.TransactionContextInterface, query *Query) error {
+	head, err := readQueryChainHead(ctx, query.ServiceID)
+	if err != nil {
+		return err
+	}
+	if head == nil {
+		head = &QueryChainHead{ServiceID: query.ServiceID}
+	}
+
+	query.PreviousHash = head.LastHash
+	query.Sequence = head.Sequence + 1
+	return nil
+}
+
+// putQueryChainLink stores the record of a linked query under its sequence index entry
+// and moves the head of the chain of its service to it
+func putQueryChainLink(ctx contractapi.TransactionContextInterface, query *Query, queryBytes []byte) error {
+	sequenceKey, err := ctx.GetStub().CreateCompositeKey(sequenceIndex, []string{query.ServiceID, formatSequence(query.Sequence), query.QueryID})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", sequenceIndex, err)
+	}
+
+	link := &QueryChainLink{Hash: queryRecordHash(queryBytes), RecordBytes: queryBytes}
+	linkBytes, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(sequenceKey, linkBytes)
+	if err != nil {
+		return fmt.Errorf("failed to PutState index %s: %v", sequenceKey, err)
+	}
+
+	head := &QueryChainHead{
+		LastHash:    link.Hash,
+		LastQueryID: query.QueryID,
+		Sequence:    query.Sequence,
+		ServiceID:   query.ServiceID,
+	}
+	headBytes, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+
+	headKey, err := ctx.GetStub().CreateCompositeKey(chainPrefix, []string{query.ServiceID})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", chainPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(headKey, headBytes)
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", headKey, err)
+	}
+
+	return nil
+}
+
+func readQueryChainHead(ctx contractapi.TransactionContextInterface, serviceID string) (*QueryChainHead, error) {
+	headKey, err := ctx.GetStub().CreateCompositeKey(chainPrefix, []string{serviceID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", chainPrefix, err)
+	}
+
+	headBytes, err := ctx.GetStub().GetState(headKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if headBytes == nil {
+		return nil, nil
+	}
+
+	var head QueryChainHead
+	err = json.Unmarshal(headBytes, &head)
+	if err != nil {
+		return nil, err
+	}
+
+	return &head, nil
+}
+
+// GetQueryChainHead returns the last link of the hash chain of a service
+func (s *QuerySmartContract) GetQueryChainHead(ctx contractapi.TransactionContextInterface, serviceID string) (*QueryChainHead, error) {
+	head, err := readQueryChainHead(ctx, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, fmt.Errorf("no query has been issued against service %s", serviceID)
+	}
+
+	return head, nil
+}
+
+// VerifyQueryChain walks the queries of a service with sequence numbers in [from, to] and checks
+// that none is missing, that every query sits at its own sequence number, that every query
+// links to the hash of the one before it, and that no query record differs from the record
+// linked into the chain other than by its legitimacy. When to is the head of the chain,
+// the head must link to the last query.
+func (s *QuerySmartContract) VerifyQueryChain(ctx contractapi.TransactionContextInterface, serviceID string, from int, to int) (*QueryChainReport, error) {
+	head, err := s.GetQueryChainHead(ctx, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if from < 1 || from > to {
+		return nil, fmt.Errorf("invalid sequence range [%d, %d]", from, to)
+	}
+	if to > head.Sequence {
+		return nil, fmt.Errorf("sequence %d is beyond the head of the chain of service %s at %d", to, serviceID, head.Sequence)
+	}
+
+	// Start one link early so that the first query in range can be checked against its predecessor
+	start := from
+	if start > 1 {
+		start--
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(sequenceIndex, []string{serviceID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	report := &QueryChainReport{
+		From:      from,
+		Issues:    []*QueryChainIssue{},
+		ServiceID: serviceID,
+		To:        to,
+	}
+	addIssue := func(sequence int, queryID string, reason string) {
+		if sequence >= from {
+			report.Issues = append(report.Issues, &QueryChainIssue{QueryID: queryID, Reason: reason, Sequence: sequence})
+		}
+	}
+
+	expected := start
+	var previousID, previousHash string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		sequence, err := strconv.Atoi(attributes[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sequence number of index key %s: %v", queryResponse.Key, err)
+		}
+		queryID := attributes[2]
+		if sequence < start {
+			continue
+		}
+		if sequence > to {
+			break
+		}
+
+		if sequence < expected {
+			addIssue(sequence, queryID, fmt.Sprintf("sequence number %d is used by more than one query", sequence))
+			continue
+		}
+		for ; expected < sequence; expected++ {
+			addIssue(expected, "", fmt.Sprintf("no query has sequence number %d", expected))
+			previousID = ""
+		}
+		expected++
+
+		var link QueryChainLink
+		var linked Query
+		err = json.Unmarshal(queryResponse.Value, &link)
+		if err == nil {
+			err = json.Unmarshal(link.RecordBytes, &linked)
+		}
+		if err != nil || link.Hash != queryRecordHash(link.RecordBytes) || linked.QueryID != queryID || linked.ServiceID != serviceID || linked.Sequence != sequence {
+			addIssue(sequence, queryID, fmt.Sprintf("the chain does not hold the record of query %s at sequence number %d", queryID, sequence))
+			previousID = ""
+			continue
+		}
+
+		if sequence == 1 && linked.PreviousHash != "" {
+			addIssue(sequence, queryID, "the first query of the chain links to a previous query")
+		}
+		if previousID != "" && linked.PreviousHash != previousHash {
+			addIssue(sequence, queryID, fmt.Sprintf("query %s does not link to the hash of query %s", queryID, previousID))
+		}
+		previousID = queryID
+		previousHash = link.Hash
+
+		query, err := s.ReadQuery(ctx, queryID)
+		if err != nil {
+			addIssue(sequence, queryID, fmt.Sprintf("query %s is indexed but its record is missing", queryID))
+			continue
+		}
+		// Reviews only ever change the legitimacy of a query
+		query.Legitimacy = linked.Legitimacy
+		if *query != linked {
+			addIssue(sequence, queryID, fmt.Sprintf("query %s differs from its record in the chain", queryID))
+		}
+	}
+
+	for ; expected <= to; expected++ {
+		addIssue(expected, "", fmt.Sprintf("no query has sequence number %d", expected))
+		previousID = ""
+	}
+
+	if to == head.Sequence && previousID != "" {
+		if previousID != head.LastQueryID || previousHash != head.LastHash {
+			addIssue(to, previousID, "the head of the chain does not link to the last query")
+		}
+	}
+
+	report.Valid = len(report.Issues) == 0
+	return report, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+// putChainedQuery stores a query the way putQuery does once every check has passed
+func putChainedQuery(t *testing.T, ctx contractapi.TransactionContextInterface, query *Query) []byte {
+	query.DocType = queryDocType
+	query.Legitimacy = legitimacyPending
+	require.NoError(t, linkQuery(ctx, query))
+
+	queryBytes, err := json.Marshal(query)
+	require.NoError(t, err)
+	putChainedRecord(t, ctx, query, queryBytes)
+	return queryBytes
+}
+
+func putChainedRecord(t *testing.T, ctx contractapi.TransactionContextInterface, query *Query, queryBytes []byte) {
+	key, err := queryKey(ctx, query.QueryID)
+	require.NoError(t, err)
+	require.NoError(t, ctx.GetStub().PutState(key, queryBytes))
+	require.NoError(t, putQueryIndexes(ctx, query))
+	require.NoError(t, putQueryChainLink(ctx, query, queryBytes))
+}
+
+func putQueryRecord(t *testing.T, ctx contractapi.TransactionContextInterface, query *Query) {
+	queryBytes, err := json.Marshal(query)
+	require.NoError(t, err)
+
+	key, err := queryKey(ctx, query.QueryID)
+	require.NoError(t, err)
+	require.NoError(t, ctx.GetStub().PutState(key, queryBytes))
+}
+
+// chainLinkBytes returns the sequence index entry of a query record
+func chainLinkBytes(t *testing.T, queryBytes []byte) []byte {
+	linkBytes, err := json.Marshal(&QueryChainLink{Hash: queryRecordHash(queryBytes), RecordBytes: queryBytes})
+	require.NoError(t, err)
+	return linkBytes
+}
+
+func newChainedQueries(t *testing.T, ctx contractapi.TransactionContextInterface, n int) []*Query {
+	var queries []*Query
+	for i := 1; i <= n; i++ {
+		query := &Query{
+			DataRows:    i,
+			InitiatorID: "initiator",
+			QueryID:     fmt.Sprintf("query%d", i),
+			ServiceID:   "service1",
+			Timestamp:   1000 + i,
+		}
+		putChainedQuery(t, ctx, query)
+		queries = append(queries, query)
+	}
+	return queries
+}
+
+func issueSequences(report *QueryChainReport) []int {
+	sequences := []int{}
+	for _, issue := range report.Issues {
+		sequences = append(sequences, issue.Sequence)
+	}
+	return sequences
+}
+
+func TestVerifyQueryChainValid(t *testing.T) {
+	ctx, _ := newTestContext()
+	queries := newChainedQueries(t, ctx, 3)
+	contract := new(QuerySmartContract)
+
+	require.Equal(t, "", queries[0].PreviousHash)
+	require.NotEqual(t, "", queries[1].PreviousHash)
+
+	report, err := contract.VerifyQueryChain(ctx, "service1", 1, 3)
+	require.NoError(t, err)
+	require.True(t, report.Valid, "issues: %+v", report.Issues)
+
+	report, err = contract.VerifyQueryChain(ctx, "service1", 2, 2)
+	require.NoError(t, err)
+	require.True(t, report.Valid, "issues: %+v", report.Issues)
+}
+
+func TestVerifyQueryChainIgnoresReviews(t *testing.T) {
+	ctx, _ := newTestContext()
+	queries := newChainedQueries(t, ctx, 3)
+
+	queries[1].Legitimacy = legitimacyApproved
+	putQueryRecord(t, ctx, queries[1])
+
+	report, err := new(QuerySmartContract).VerifyQueryChain(ctx, "service1", 1, 3)
+	require.NoError(t, err)
+	require.True(t, report.Valid, "issues: %+v", report.Issues)
+}
+
+func TestVerifyQueryChainTamperedRecord(t *testing.T) {
+	ctx, _ := newTestContext()
+	queries := newChainedQueries(t, ctx, 3)
+
+	queries[1].DataRows = 1000
+	putQueryRecord(t, ctx, queries[1])
+
+	report, err := new(QuerySmartContract).VerifyQueryChain(ctx, "service1", 1, 3)
+	require.NoError(t, err)
+	require.False(t, report.Valid)
+	require.Equal(t, []int{2}, issueSequences(report))
+	require.Equal(t, "query2", report.Issues[0].QueryID)
+}
+
+func TestVerifyQueryChainTamperedLink(t *testing.T) {
+	ctx, stub := newTestContext()
+	queries := newChainedQueries(t, ctx, 3)
+
+	// Rewrite the record and its link consistently, the next query still links to the original
+	queries[1].DataRows = 1000
+	queryBytes, err := json.Marshal(queries[1])
+	require.NoError(t, err)
+	putQueryRecord(t, ctx, queries[1])
+	sequenceKey, err := stub.CreateCompositeKey(sequenceIndex, []string{"service1", formatSequence(2), "query2"})
+	require.NoError(t, err)
+	require.NoError(t, stub.PutState(sequenceKey, chainLinkBytes(t, queryBytes)))
+
+	report, err := new(QuerySmartContract).VerifyQueryChain(ctx, "service1", 1, 3)
+	require.NoError(t, err)
+	require.False(t, report.Valid)
+	require.Equal(t, []int{3}, issueSequences(report))
+
+	// Tampering with the last query shows at the head of the chain
+	queries[2].DataRows = 1000
+	queryBytes, err = json.Marshal(queries[2])
+	require.NoError(t, err)
+	putQueryRecord(t, ctx, queries[2])
+	sequenceKey, err = stub.CreateCompositeKey(sequenceIndex, []string{"service1", formatSequence(3), "query3"})
+	require.NoError(t, err)
+	require.NoError(t, stub.PutState(sequenceKey, chainLinkBytes(t, queryBytes)))
+
+	report, err = new(QuerySmartContract).VerifyQueryChain(ctx, "service1", 3, 3)
+	require.NoError(t, err)
+	require.False(t, report.Valid)
+	require.Equal(t, "the head of the chain does not link to the last query", report.Issues[len(report.Issues)-1].Reason)
+}
+
+func TestVerifyQueryChainTamperedLinkHash(t *testing.T) {
+	ctx, stub := newTestContext()
+	queries := newChainedQueries(t, ctx, 3)
+
+	queryBytes, err := json.Marshal(queries[1])
+	require.NoError(t, err)
+	sequenceKey, err := stub.CreateCompositeKey(sequenceIndex, []string{"service1", formatSequence(2), "query2"})
+	require.NoError(t, err)
+	linkBytes, err := json.Marshal(&QueryChainLink{Hash: queryRecordHash([]byte("another record")), RecordBytes: queryBytes})
+	require.NoError(t, err)
+	require.NoError(t, stub.PutState(sequenceKey, linkBytes))
+
+	report, err := new(QuerySmartContract).VerifyQueryChain(ctx, "service1", 1, 3)
+	require.NoError(t, err)
+	require.False(t, report.Valid)
+	require.Equal(t, 2, report.Issues[0].Sequence)
+}
+
+// On CouchDB the sequence index entries are documents too, and must not match selectors on query fields
+func TestChainLinksAreNotSelectedAsQueries(t *testing.T) {
+	network := newTestNetworkOn(t, true)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+
+	var querys []*Query
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, user, "GetQueriesByService", testServiceID), &querys))
+	require.Len(t, querys, 1)
+	require.Equal(t, "query1", querys[0].QueryID)
+
+	page := new(PaginatedQueryResult)
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, user, "GetQueriesByServiceWithPagination", testServiceID, "10", ""), page))
+	require.Len(t, page.Records, 1)
+}
+
+func TestVerifyQueryChainMissingQuery(t *testing.T) {
+	ctx, stub := newTestContext()
+	newChainedQueries(t, ctx, 3)
+
+	sequenceKey, err := stub.CreateCompositeKey(sequenceIndex, []string{"service1", formatSequence(2), "query2"})
+	require.NoError(t, err)
+	require.NoError(t, stub.DelState(sequenceKey))
+
+	report, err := new(QuerySmartContract).VerifyQueryChain(ctx, "service1", 1, 3)
+	require.NoError(t, err)
+	require.False(t, report.Valid)
+	require.Equal(t, []int{2}, issueSequences(report))
+}
+
+// Records created before a field was added to Query must keep verifying
+func TestVerifyQueryChainRecordWithoutLaterFields(t *testing.T) {
+	ctx, _ := newTestContext()
+
+	older := &Query{DocType: queryDocType, Legitimacy: legitimacyPending, QueryID: "query1", ServiceID: "service1"}
+	require.NoError(t, linkQuery(ctx, older))
+	olderBytes := []byte(`{"DocType":"query","Legitimacy":"pending","PreviousHash":"","QueryID":"query1","Sequence":1,"ServiceID":"service1"}`)
+	putChainedRecord(t, ctx, older, olderBytes)
+
+	newer := &Query{Epsilon: 0.5, QueryID: "query2", ServiceID: "service1"}
+	putChainedQuery(t, ctx, newer)
+	require.Equal(t, queryRecordHash(olderBytes), newer.PreviousHash)
+
+	report, err := new(QuerySmartContract).VerifyQueryChain(ctx, "service1", 1, 2)
+	require.NoError(t, err)
+	require.True(t, report.Valid, "issues: %+v", report.Issues)
+}
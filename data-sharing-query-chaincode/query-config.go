@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType name for contract options
+const configPrefix = "config"
+
+// Define key names for options
+const ownerMSPIDKey = "ownerMSPID"
+const serviceChaincodeKey = "serviceChaincode"
+const stateDatabaseKey = "stateDatabase"
+
+// Service is the part of a service registry entry of the service chaincode that the query chaincode reads.
+// A query against the service costs Price plus PricePerRow for every returned row, paid to OwnerID.
+type Service struct {
+	ServiceID     string `json:"serviceID"`
+	ProviderMSPID string `json:"providerMSPID"`
+	OwnerID       string `json:"ownerID"`
+	Price         int    `json:"price"`
+	PricePerRow   int    `json:"pricePerRow"`
+	Status        string `json:"status"`
+}
+
+// Define the state databases the peers may keep world state in
+const stateDatabaseLevelDB = "leveldb"
+const stateDatabaseCouchDB = "couchdb"
+
+// Initialize sets the contract owner, the name of the service (ERC721 card) chaincode
+// that CreateQuery checks card ownership against, and the state database of the peers,
+// leveldb or couchdb, which decides how filtered lookups are answered. It can only be called once.
+func (s *QuerySmartContract) Initialize(ctx contractapi.TransactionContextInterface, ownerMSPID string, serviceChaincode string, stateDatabase string) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+	if clientMSPID != ownerMSPID {
+		return fmt.Errorf("client is not authorized to initialize the contract")
+	}
+
+	owner, err := getConfig(ctx, ownerMSPIDKey)
+	if err != nil {
+		return err
+	}
+	if owner != "" {
+		return fmt.Errorf("contract options are already set, client is not authorized to change them")
+	}
+
+	err = checkStateDatabase(stateDatabase)
+	if err != nil {
+		return err
+	}
+
+	err = putConfig(ctx, ownerMSPIDKey, ownerMSPID)
+	if err != nil {
+		return err
+	}
+
+	err = putConfig(ctx, serviceChaincodeKey, serviceChaincode)
+	if err != nil {
+		return err
+	}
+
+	return putConfig(ctx, stateDatabaseKey, stateDatabase)
+}
+
+// SetServiceChaincode changes the name of the service chaincode. Only the contract owner may call it.
+func (s *QuerySmartContract) SetServiceChaincode(ctx contractapi.TransactionContextInterface, serviceChaincode string) error {
+	err := assertOwner(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putConfig(ctx, serviceChaincodeKey, serviceChaincode)
+}
+
+// SetStateDatabase changes the state database the contract assumes, leveldb or couchdb.
+// Only the contract owner may call it.
+func (s *QuerySmartContract) SetStateDatabase(ctx contractapi.TransactionContextInterface, stateDatabase string) error {
+	err := assertOwner(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = checkStateDatabase(stateDatabase)
+	if err != nil {
+		return err
+	}
+
+	return putConfig(ctx, stateDatabaseKey, stateDatabase)
+}
+
+// StateDatabase returns the state database the contract assumes
+func (s *QuerySmartContract) StateDatabase(ctx contractapi.TransactionContextInterface) (string, error) {
+	stateDatabase, err := getConfig(ctx, stateDatabaseKey)
+	if err != nil {
+		return "", err
+	}
+	if stateDatabase == "" {
+		return stateDatabaseLevelDB, nil
+	}
+
+	return stateDatabase, nil
+}
+
+// OwnerMSPID returns the MSP of the contract owner
+func (s *QuerySmartContract) OwnerMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	return getRequiredConfig(ctx, ownerMSPIDKey)
+}
+
+// ServiceChaincode returns the name of the service chaincode
+func (s *QuerySmartContract) ServiceChaincode(ctx contractapi.TransactionContextInterface) (string, error) {
+	return getRequiredConfig(ctx, serviceChaincodeKey)
+}
+
+// getConfig returns a contract option, or an empty string if it is not set
+func getConfig(ctx contractapi.TransactionContextInterface, name string) (string, error) {
+	configKey, err := ctx.GetStub().CreateCompositeKey(configPrefix, []string{name})
+	if err != nil {
+		return "", fmt.Errorf("failed to CreateCompositeKey %s: %v", configPrefix, err)
+	}
+
+	valueBytes, err := ctx.GetStub().GetState(configKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s: %v", name, err)
+	}
+
+	return string(valueBytes), nil
+}
+
+// getRequiredConfig returns a contract option and fails if the contract has not been initialized
+func getRequiredConfig(ctx contractapi.TransactionContextInterface, name string) (string, error) {
+	value, err := getConfig(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("contract option %s is not set, call Initialize() to initialize contract", name)
+	}
+
+	return value, nil
+}
+
+func putConfig(ctx contractapi.TransactionContextInterface, name string, value string) error {
+	configKey, err := ctx.GetStub().CreateCompositeKey(configPrefix, []string{name})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", configPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(configKey, []byte(value))
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func checkStateDatabase(stateDatabase string) error {
+	if stateDatabase != stateDatabaseLevelDB && stateDatabase != stateDatabaseCouchDB {
+		return fmt.Errorf("state database must be %s or %s, got %q", stateDatabaseLevelDB, stateDatabaseCouchDB, stateDatabase)
+	}
+
+	return nil
+}
+
+// richQueriesEnabled tells whether the peers keep world state in CouchDB and so answer selector queries.
+// Contracts initialized before the option existed use the composite-key indexes, which work on both databases.
+func richQueriesEnabled(ctx contractapi.TransactionContextInterface) (bool, error) {
+	stateDatabase, err := getConfig(ctx, stateDatabaseKey)
+	if err != nil {
+		return false, err
+	}
+
+	return stateDatabase == stateDatabaseCouchDB, nil
+}
+
+// assertOwner checks that the submitting client belongs to the contract owner MSP
+func assertOwner(ctx contractapi.TransactionContextInterface) error {
+	ownerMSPID, err := getRequiredConfig(ctx, ownerMSPIDKey)
+	if err != nil {
+		return err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+	if clientMSPID != ownerMSPID {
+		return fmt.Errorf("client from org %s is not the contract owner", clientMSPID)
+	}
+
+	return nil
+}
+
+// findCard asks the service chaincode for a card of the initiator for the service and returns its token ID
+func findCard(ctx contractapi.TransactionContextInterface, initiatorID string, serviceID string) (string, error) {
+	serviceChaincode, err := getRequiredConfig(ctx, serviceChaincodeKey)
+	if err != nil {
+		return "", err
+	}
+
+	args := [][]byte{[]byte("TokenOfOwnerByService"), []byte(initiatorID), []byte(serviceID)}
+	response := ctx.GetStub().InvokeChaincode(serviceChaincode, args, "")
+	if response.Status != shim.OK {
+		return "", fmt.Errorf("the initiator holds no card for service %s: %s", serviceID, response.Message)
+	}
+
+	return string(response.Payload), nil
+}
+
+// readService reads a service from the registry of the service chaincode
+func readService(ctx contractapi.TransactionContextInterface, serviceID string) (*Service, error) {
+	serviceChaincode, err := getRequiredConfig(ctx, serviceChaincodeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	args := [][]byte{[]byte("ReadService"), []byte(serviceID)}
+	response := ctx.GetStub().InvokeChaincode(serviceChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to read service %s: %s", serviceID, response.Message)
+	}
+
+	service := new(Service)
+	err = json.Unmarshal(response.Payload, service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Unmarshal service %s: %v", serviceID, err)
+	}
+
+	return service, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitializeOnlyOnce(t *testing.T) {
+	network := newTestNetwork(t)
+
+	_, err := network.invoke(t, network.admin, "Initialize", testMSPID, testCardsChaincode, stateDatabaseLevelDB)
+	require.EqualError(t, err, "contract options are already set, client is not authorized to change them")
+	require.Equal(t, testMSPID, string(network.mustInvoke(t, network.admin, "OwnerMSPID")))
+}
+
+func TestCreateQueryRecordsCard(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+	require.Equal(t, "card-"+hashField(user.id(t))[:8], network.readQuery(t, "query1").CardTokenID)
+
+	detailsBytes, err := json.Marshal(user.details(t, "query2", "SELECT * FROM "+testTable))
+	require.NoError(t, err)
+	_, err = network.invokeWithTransient(t, user, map[string][]byte{transientQueryKey: detailsBytes},
+		"CreateQuery", testDataDigest, "3", "0", "query2", "service2")
+	require.EqualError(t, err, fmt.Sprintf("the initiator holds no card for service service2: %s holds no valid card for service service2", user.id(t)))
+	require.Nil(t, network.readQuery(t, "query2"))
+}
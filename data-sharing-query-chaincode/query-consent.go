@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for table owners and the consents they grant.
+// Tables are identified by the SHA-256 hash of their name (hashField),
+// so that table names never appear in world state or transaction arguments.
+const tableOwnerPrefix = "tableOwner"
+const consentPrefix = "consent"
+
+// Consent allows the clients of a grantee MSP to query a table for a purpose within a validity window.
+// A ValidUntil of 0 keeps the consent valid until it is revoked.
+type Consent struct {
+	GranteeMSPID string `json:"GranteeMSPID"`
+	GrantedAt    int    `json:"GrantedAt"`
+	GrantorID    string `json:"GrantorID"`
+	OwnerMSPID   string `json:"OwnerMSPID"`
+	Purpose      string `json:"Purpose"`
+	Revoked      bool   `json:"Revoked"`
+	TableHash    string `json:"TableHash"`
+	ValidFrom    int    `json:"ValidFrom"`
+	ValidUntil   int    `json:"ValidUntil"`
+}
+
+// SetTableOwner records the MSP of the data owner of a table. Only the contract owner may call it.
+func (s *QuerySmartContract) SetTableOwner(ctx contractapi.TransactionContextInterface, tableHash string, ownerMSPID string) error {
+	err := assertOwner(ctx)
+	if err != nil {
+		return err
+	}
+
+	tableOwnerKey, err := ctx.GetStub().CreateCompositeKey(tableOwnerPrefix, []string{tableHash})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", tableOwnerPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(tableOwnerKey, []byte(ownerMSPID))
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", tableOwnerKey, err)
+	}
+
+	return nil
+}
+
+// ReadTableOwner returns the MSP of the data owner of a table
+func (s *QuerySmartContract) ReadTableOwner(ctx contractapi.TransactionContextInterface, tableHash string) (string, error) {
+	tableOwnerKey, err := ctx.GetStub().CreateCompositeKey(tableOwnerPrefix, []string{tableHash})
+	if err != nil {
+		return "", fmt.Errorf("failed to CreateCompositeKey %s: %v", tableOwnerPrefix, err)
+	}
+
+	ownerBytes, err := ctx.GetStub().GetState(tableOwnerKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if ownerBytes == nil {
+		return "", fmt.Errorf("the table %s has no owner", tableHash)
+	}
+
+	return string(ownerBytes), nil
+}
+
+// GrantConsent allows a grantee MSP to query a table for a purpose from validFrom until validUntil.
+// Only clients of the table owner's MSP may call it. Granting again replaces the previous consent.
+func (s *QuerySmartContract) GrantConsent(ctx contractapi.TransactionContextInterface, tableHash string, granteeMSPID string, purpose string, validFrom int, validUntil int) (*Consent, error) {
+	ownerMSPID, err := s.assertTableOwner(ctx, tableHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if purpose == "" {
+		return nil, fmt.Errorf("a purpose is required to grant consent")
+	}
+	if validUntil != 0 && validUntil < validFrom {
+		return nil, fmt.Errorf("the consent would end at %d before it starts at %d", validUntil, validFrom)
+	}
+
+	grantorID, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := getTxTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	consent := &Consent{
+		GranteeMSPID: granteeMSPID,
+		GrantedAt:    now,
+		GrantorID:    grantorID,
+		OwnerMSPID:   ownerMSPID,
+		Purpose:      purpose,
+		TableHash:    tableHash,
+		ValidFrom:    validFrom,
+		ValidUntil:   validUntil,
+	}
+
+	return consent, putConsent(ctx, consent)
+}
+
+// RevokeConsent withdraws the consent of a grantee MSP to query a table for a purpose.
+// Only clients of the table owner's MSP may call it.
+func (s *QuerySmartContract) RevokeConsent(ctx contractapi.TransactionContextInterface, tableHash string, granteeMSPID string, purpose string) (*Consent, error) {
+	_, err := s.assertTableOwner(ctx, tableHash)
+	if err != nil {
+		return nil, err
+	}
+
+	consent, err := s.ReadConsent(ctx, tableHash, granteeMSPID, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	consent.Revoked = true
+	return consent, putConsent(ctx, consent)
+}
+
+// ReadConsent returns the consent of a grantee MSP to query a table for a purpose
+func (s *QuerySmartContract) ReadConsent(ctx contractapi.TransactionContextInterface, tableHash string, granteeMSPID string, purpose string) (*Consent, error) {
+	consentKey, err := ctx.GetStub().CreateCompositeKey(consentPrefix, []string{tableHash, granteeMSPID, purpose})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", consentPrefix, err)
+	}
+
+	consentBytes, err := ctx.GetStub().GetState(consentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if consentBytes == nil {
+		return nil, fmt.Errorf("%s has no consent to query table %s for %s", granteeMSPID, tableHash, purpose)
+	}
+
+	var consent Consent
+	err = json.Unmarshal(consentBytes, &consent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+// GetConsentsByTable returns every consent granted on a table, including revoked and expired ones
+func (s *QuerySmartContract) GetConsentsByTable(ctx contractapi.TransactionContextInterface, tableHash string) ([]*Consent, error) {
+	return getConsents(ctx, []string{tableHash})
+}
+
+// checkConsent fails unless the initiator MSP holds an active consent, for any purpose, on the table
+func checkConsent(ctx contractapi.TransactionContextInterface, tableHash string, initiatorMSPID string) error {
+	consents, err := getConsents(ctx, []string{tableHash, initiatorMSPID})
+	if err != nil {
+		return err
+	}
+
+	now, err := getTxTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, consent := range consents {
+		if !consent.Revoked && consent.ValidFrom <= now && (consent.ValidUntil == 0 || now <= consent.ValidUntil) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s has no active consent to query table %s", initiatorMSPID, tableHash)
+}
+
+func getConsents(ctx contractapi.TransactionContextInterface, attributes []string) ([]*Consent, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(consentPrefix, attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKey %s: %v", consentPrefix, err)
+	}
+	defer resultsIterator.Close()
+
+	var consents []*Consent
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var consent Consent
+		err = json.Unmarshal(response.Value, &consent)
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, &consent)
+	}
+
+	return consents, nil
+}
+
+// putConsent stores a consent and emits the Consent event
+func putConsent(ctx contractapi.TransactionContextInterface, consent *Consent) error {
+	consentKey, err := ctx.GetStub().CreateCompositeKey(consentPrefix, []string{consent.TableHash, consent.GranteeMSPID, consent.Purpose})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", consentPrefix, err)
+	}
+
+	consentBytes, err := json.Marshal(consent)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(consentKey, consentBytes)
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", consentKey, err)
+	}
+
+	err = ctx.GetStub().SetEvent("Consent", consentBytes)
+	if err != nil {
+		return fmt.Errorf("failed to SetEvent Consent: %v", err)
+	}
+
+	return nil
+}
+
+// assertTableOwner checks that the submitting client belongs to the data owner MSP of a table and returns that MSP
+func (s *QuerySmartContract) assertTableOwner(ctx contractapi.TransactionContextInterface, tableHash string) (string, error) {
+	ownerMSPID, err := s.ReadTableOwner(ctx, tableHash)
+	if err != nil {
+		return "", err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+	if clientMSPID != ownerMSPID {
+		return "", fmt.Errorf("client from org %s is not the owner of table %s", clientMSPID, tableHash)
+	}
+
+	return ownerMSPID, nil
+}
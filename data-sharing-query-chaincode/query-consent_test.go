@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateQueryRequiresActiveConsent(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	tableHash := hashField(testTable)
+	noConsent := fmt.Sprintf("%s has no active consent to query table %s", testMSPID, tableHash)
+
+	network.mustInvoke(t, network.admin, "RevokeConsent", tableHash, testMSPID, "research")
+	require.EqualError(t, network.createQuery(t, user, "query1", 3), noConsent)
+
+	now := time.Now().Unix()
+	network.mustInvoke(t, network.admin, "GrantConsent", tableHash, testMSPID, "audit", fmt.Sprint(now+3600), "0")
+	require.EqualError(t, network.createQuery(t, user, "query1", 3), noConsent)
+	network.mustInvoke(t, network.admin, "GrantConsent", tableHash, testMSPID, "billing", "0", fmt.Sprint(now-60))
+	require.EqualError(t, network.createQuery(t, user, "query1", 3), noConsent)
+
+	network.mustInvoke(t, network.admin, "GrantConsent", tableHash, testMSPID, "research", fmt.Sprint(now-60), fmt.Sprint(now+3600))
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+
+	var consents []*Consent
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, user, "GetConsentsByTable", tableHash), &consents))
+	require.Len(t, consents, 3)
+}
+
+func TestGrantConsent(t *testing.T) {
+	network := newTestNetwork(t)
+	tableHash := hashField(testTable)
+
+	_, err := network.invoke(t, network.admin, "GrantConsent", tableHash, "Org2MSP", "", "0", "0")
+	require.EqualError(t, err, "a purpose is required to grant consent")
+	_, err = network.invoke(t, network.admin, "GrantConsent", tableHash, "Org2MSP", "research", "200", "100")
+	require.EqualError(t, err, "the consent would end at 100 before it starts at 200")
+	_, err = network.invoke(t, network.admin, "GrantConsent", hashField("other_table"), "Org2MSP", "research", "0", "0")
+	require.EqualError(t, err, fmt.Sprintf("the table %s has no owner", hashField("other_table")))
+
+	outsider := network.ca.enroll(t, "user2", "client", nil)
+	outsider.mspID = "Org2MSP"
+	_, err = network.invoke(t, outsider, "GrantConsent", tableHash, "Org2MSP", "research", "0", "0")
+	require.EqualError(t, err, fmt.Sprintf("client from org Org2MSP is not the owner of table %s", tableHash))
+
+	consent := new(Consent)
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, network.admin, "GrantConsent", tableHash, "Org2MSP", "research", "0", "0"), consent))
+	require.Equal(t, testMSPID, consent.OwnerMSPID)
+	require.Equal(t, network.admin.id(t), consent.GrantorID)
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Dispute states. A dispute is open until the other side responds and stays responded
+// until an arbitrator resolves it.
+const disputeOpen = "open"
+const disputeResponded = "responded"
+const disputeResolved = "resolved"
+
+// Outcomes an arbitrator may resolve a dispute with
+const disputeUpheld = "upheld"
+const disputeDismissed = "dismissed"
+
+// Define objectType names for disputes and their indexes
+const disputePrefix = "dispute"
+const disputeQueryIndex = "query~dispute"
+const disputeStatusIndex = "status~dispute"
+
+// Identities allowed to resolve disputes carry this certificate attribute
+const arbitratorAttribute = "arbitrator"
+
+// DisputeResponse is one answer to a dispute
+type DisputeResponse struct {
+	EvidenceDigest string `json:"EvidenceDigest"`
+	Response       string `json:"Response"`
+	ResponderID    string `json:"ResponderID"`
+	ResponderMSPID string `json:"ResponderMSPID"`
+	Timestamp      int    `json:"Timestamp"`
+}
+
+// Dispute is a complaint about a logged query, raised by its initiator who believes the data
+// does not match its DataDigest, or by the provider of the service who believes the query was
+// illegitimate, and answered by the other side.
+// The evidence itself stays off chain; only its SHA-256 digest is recorded.
+type Dispute struct {
+	DisputeID      string             `json:"DisputeID"`
+	EvidenceDigest string             `json:"EvidenceDigest"`
+	Outcome        string             `json:"Outcome"`
+	QueryID        string             `json:"QueryID"`
+	RaisedAt       int                `json:"RaisedAt"`
+	RaiserID       string             `json:"RaiserID"`
+	RaiserMSPID    string             `json:"RaiserMSPID"`
+	Reason         string             `json:"Reason"`
+	Resolution     string             `json:"Resolution"`
+	ResolvedAt     int                `json:"ResolvedAt"`
+	ResolverID     string             `json:"ResolverID"`
+	ResolverMSPID  string             `json:"ResolverMSPID"`
+	Responses      []*DisputeResponse `json:"Responses"`
+	Status         string             `json:"Status"`
+}
+
+// RaiseDispute opens a dispute about a query and emits the DisputeRaised event.
+// Only the initiator of the query or the provider of its service may raise it.
+// The dispute ID is the transaction ID. evidenceDigest is the hex encoded SHA-256 digest of the evidence.
+func (s *QuerySmartContract) RaiseDispute(ctx contractapi.TransactionContextInterface, queryID string, reason string, evidenceDigest string) (*Dispute, error) {
+	query, err := s.ReadQuery(ctx, queryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to dispute query %s", queryID)
+	}
+
+	err = validateEvidenceDigest(evidenceDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	raiserID, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	raiserMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+	if raiserID != query.InitiatorID || raiserMSPID != query.InitiatorMSPID {
+		provider, err := isServiceProvider(ctx, query, raiserID, raiserMSPID)
+		if err != nil {
+			return nil, err
+		}
+		if !provider {
+			return nil, fmt.Errorf("only the initiator of query %s or the provider of service %s may dispute it", queryID, query.ServiceID)
+		}
+	}
+
+	timestamp, err := getTxTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dispute := &Dispute{
+		DisputeID:      ctx.GetStub().GetTxID(),
+		EvidenceDigest: evidenceDigest,
+		QueryID:        queryID,
+		RaisedAt:       timestamp,
+		RaiserID:       raiserID,
+		RaiserMSPID:    raiserMSPID,
+		Reason:         reason,
+		Responses:      []*DisputeResponse{},
+		Status:         disputeOpen,
+	}
+
+	err = putDispute(ctx, dispute, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return dispute, emitDisputeEvent(ctx, "DisputeRaised", dispute)
+}
+
+// RespondToDispute answers an unresolved dispute and emits the DisputeResponded event.
+// Only the other side may respond: the provider of the service to a dispute raised by the initiator,
+// and the initiator to a dispute raised by the provider. evidenceDigest may be empty.
+func (s *QuerySmartContract) RespondToDispute(ctx contractapi.TransactionContextInterface, disputeID string, response string, evidenceDigest string) (*Dispute, error) {
+	dispute, err := s.ReadDispute(ctx, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if dispute.Status == disputeResolved {
+		return nil, fmt.Errorf("the dispute %s is already resolved", disputeID)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("a response is required to answer dispute %s", disputeID)
+	}
+	if evidenceDigest != "" {
+		err = validateEvidenceDigest(evidenceDigest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	responderID, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	responderMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+	if responderID == dispute.RaiserID && responderMSPID == dispute.RaiserMSPID {
+		return nil, fmt.Errorf("the client who raised dispute %s cannot respond to it", disputeID)
+	}
+
+	query, err := s.ReadQuery(ctx, dispute.QueryID)
+	if err != nil {
+		return nil, err
+	}
+	if dispute.RaiserID != query.InitiatorID || dispute.RaiserMSPID != query.InitiatorMSPID {
+		if responderID != query.InitiatorID || responderMSPID != query.InitiatorMSPID {
+			return nil, fmt.Errorf("only the initiator of query %s may respond to dispute %s", query.QueryID, disputeID)
+		}
+	} else {
+		provider, err := isServiceProvider(ctx, query, responderID, responderMSPID)
+		if err != nil {
+			return nil, err
+		}
+		if !provider {
+			return nil, fmt.Errorf("only the provider of service %s may respond to dispute %s", query.ServiceID, disputeID)
+		}
+	}
+
+	timestamp, err := getTxTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dispute.Responses = append(dispute.Responses, &DisputeResponse{
+		EvidenceDigest: evidenceDigest,
+		Response:       response,
+		ResponderID:    responderID,
+		ResponderMSPID: responderMSPID,
+		Timestamp:      timestamp,
+	})
+
+	fromStatus := dispute.Status
+	dispute.Status = disputeResponded
+	err = putDispute(ctx, dispute, fromStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	return dispute, emitDisputeEvent(ctx, "DisputeResponded", dispute)
+}
+
+// ResolveDispute closes a dispute as upheld or dismissed and emits the DisputeResolved event.
+// Only arbitrators may call it.
+func (s *QuerySmartContract) ResolveDispute(ctx contractapi.TransactionContextInterface, disputeID string, outcome string, resolution string) (*Dispute, error) {
+	if outcome != disputeUpheld && outcome != disputeDismissed {
+		return nil, fmt.Errorf("outcome must be %s or %s, got %q", disputeUpheld, disputeDismissed, outcome)
+	}
+	if resolution == "" {
+		return nil, fmt.Errorf("a resolution is required to resolve dispute %s", disputeID)
+	}
+
+	dispute, err := s.ReadDispute(ctx, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if dispute.Status == disputeResolved {
+		return nil, fmt.Errorf("the dispute %s is already resolved", disputeID)
+	}
+
+	resolverID, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resolverMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+
+	timestamp, err := getTxTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fromStatus := dispute.Status
+	dispute.Outcome = outcome
+	dispute.Resolution = resolution
+	dispute.ResolvedAt = timestamp
+	dispute.ResolverID = resolverID
+	dispute.ResolverMSPID = resolverMSPID
+	dispute.Status = disputeResolved
+	err = putDispute(ctx, dispute, fromStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	return dispute, emitDisputeEvent(ctx, "DisputeResolved", dispute)
+}
+
+// ReadDispute returns the dispute with given id
+func (s *QuerySmartContract) ReadDispute(ctx contractapi.TransactionContextInterface, disputeID string) (*Dispute, error) {
+	disputeKey, err := ctx.GetStub().CreateCompositeKey(disputePrefix, []string{disputeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", disputePrefix, err)
+	}
+
+	disputeBytes, err := ctx.GetStub().GetState(disputeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if disputeBytes == nil {
+		return nil, fmt.Errorf("the dispute %s does not exist", disputeID)
+	}
+
+	var dispute Dispute
+	err = json.Unmarshal(disputeBytes, &dispute)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dispute, nil
+}
+
+// GetDisputesByQuery returns all disputes raised about a query
+func (s *QuerySmartContract) GetDisputesByQuery(ctx contractapi.TransactionContextInterface, queryID string) ([]*Dispute, error) {
+	return s.getDisputesByIndex(ctx, disputeQueryIndex, []string{queryID})
+}
+
+// GetDisputesByStatus returns all disputes in a state: open, responded or resolved
+func (s *QuerySmartContract) GetDisputesByStatus(ctx contractapi.TransactionContextInterface, status string) ([]*Dispute, error) {
+	if status != disputeOpen && status != disputeResponded && status != disputeResolved {
+		return nil, fmt.Errorf("status must be %s, %s or %s, got %q", disputeOpen, disputeResponded, disputeResolved, status)
+	}
+
+	return s.getDisputesByIndex(ctx, disputeStatusIndex, []string{status})
+}
+
+func (s *QuerySmartContract) getDisputesByIndex(ctx contractapi.TransactionContextInterface, objectType string, attributes []string) ([]*Dispute, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKey %s: %v", objectType, err)
+	}
+	defer iterator.Close()
+
+	return s.readDisputesFromIndexIterator(ctx, iterator)
+}
+
+// readDisputesFromIndexIterator resolves every composite index key returned by an iterator to its dispute
+func (s *QuerySmartContract) readDisputesFromIndexIterator(ctx contractapi.TransactionContextInterface, iterator shim.StateQueryIteratorInterface) ([]*Dispute, error) {
+	var disputes []*Dispute
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to SplitCompositeKey %s: %v", response.Key, err)
+		}
+
+		dispute, err := s.ReadDispute(ctx, compositeKeyParts[len(compositeKeyParts)-1])
+		if err != nil {
+			return nil, err
+		}
+		disputes = append(disputes, dispute)
+	}
+
+	return disputes, nil
+}
+
+// putDispute stores a dispute and its index entries. fromStatus is the state the dispute
+// leaves, whose index entry is removed, or empty for a new dispute.
+func putDispute(ctx contractapi.TransactionContextInterface, dispute *Dispute, fromStatus string) error {
+	disputeBytes, err := json.Marshal(dispute)
+	if err != nil {
+		return err
+	}
+
+	disputeKey, err := ctx.GetStub().CreateCompositeKey(disputePrefix, []string{dispute.DisputeID})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", disputePrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(disputeKey, disputeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", disputeKey, err)
+	}
+
+	if fromStatus == dispute.Status {
+		return nil
+	}
+
+	if fromStatus == "" {
+		queryIndexKey, err := ctx.GetStub().CreateCompositeKey(disputeQueryIndex, []string{dispute.QueryID, dispute.DisputeID})
+		if err != nil {
+			return fmt.Errorf("failed to CreateCompositeKey %s: %v", disputeQueryIndex, err)
+		}
+		err = ctx.GetStub().PutState(queryIndexKey, []byte{0x00})
+		if err != nil {
+			return fmt.Errorf("failed to PutState %s: %v", queryIndexKey, err)
+		}
+	} else {
+		oldIndexKey, err := ctx.GetStub().CreateCompositeKey(disputeStatusIndex, []string{fromStatus, dispute.DisputeID})
+		if err != nil {
+			return fmt.Errorf("failed to CreateCompositeKey %s: %v", disputeStatusIndex, err)
+		}
+		err = ctx.GetStub().DelState(oldIndexKey)
+		if err != nil {
+			return fmt.Errorf("failed to DelState %s: %v", oldIndexKey, err)
+		}
+	}
+
+	newIndexKey, err := ctx.GetStub().CreateCompositeKey(disputeStatusIndex, []string{dispute.Status, dispute.DisputeID})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", disputeStatusIndex, err)
+	}
+	err = ctx.GetStub().PutState(newIndexKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", newIndexKey, err)
+	}
+
+	return nil
+}
+
+func emitDisputeEvent(ctx contractapi.TransactionContextInterface, name string, dispute *Dispute) error {
+	disputeBytes, err := json.Marshal(dispute)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(name, disputeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to SetEvent %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// isServiceProvider checks whether a client provides the service of a query: it belongs to the provider MSP
+// of the service in the service registry, or it is the service client that submitted the query on behalf of the initiator
+func isServiceProvider(ctx contractapi.TransactionContextInterface, query *Query, clientID string, clientMSPID string) (bool, error) {
+	delegated := query.SubmitterID != query.InitiatorID || query.SubmitterMSPID != query.InitiatorMSPID
+	if delegated && clientID == query.SubmitterID && clientMSPID == query.SubmitterMSPID {
+		return true, nil
+	}
+
+	service, err := readService(ctx, query.ServiceID)
+	if err != nil {
+		return false, err
+	}
+
+	return clientMSPID == service.ProviderMSPID, nil
+}
+
+// validateEvidenceDigest checks that an evidence digest is a hex encoded SHA-256 digest
+func validateEvidenceDigest(evidenceDigest string) error {
+	digest, err := hex.DecodeString(evidenceDigest)
+	if err != nil || len(digest) != sha256.Size {
+		return fmt.Errorf("evidenceDigest must be the hex encoded SHA-256 digest of the evidence")
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testEvidenceDigest = hashField("evidence")
+
+func raiseDispute(t *testing.T, network *testNetwork, client *testClient, queryID string) (*Dispute, error) {
+	payload, err := network.invoke(t, client, "RaiseDispute", queryID, "the rows do not match the digest", testEvidenceDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	var dispute Dispute
+	require.NoError(t, json.Unmarshal(payload, &dispute))
+	return &dispute, nil
+}
+
+func TestRaiseDisputeByInitiatorOrProvider(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	other := network.ca.enroll(t, "user2", "client", nil)
+	provider := network.ca.enroll(t, "provider", "client", nil)
+	provider.mspID = testProviderMSPID
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+
+	_, err := raiseDispute(t, network, other, "query1")
+	require.EqualError(t, err, "only the initiator of query query1 or the provider of service service1 may dispute it")
+	_, err = raiseDispute(t, network, network.admin, "query1")
+	require.EqualError(t, err, "only the initiator of query query1 or the provider of service service1 may dispute it")
+
+	dispute, err := raiseDispute(t, network, user, "query1")
+	require.NoError(t, err)
+	require.Equal(t, user.id(t), dispute.RaiserID)
+	require.Equal(t, disputeOpen, dispute.Status)
+
+	dispute, err = raiseDispute(t, network, provider, "query1")
+	require.NoError(t, err)
+	require.Equal(t, provider.id(t), dispute.RaiserID)
+	require.Equal(t, testProviderMSPID, dispute.RaiserMSPID)
+}
+
+func TestRespondToDisputeOnlyByServiceProvider(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	other := network.ca.enroll(t, "user2", "client", nil)
+	provider := network.ca.enroll(t, "provider", "client", nil)
+	provider.mspID = testProviderMSPID
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+
+	dispute, err := raiseDispute(t, network, user, "query1")
+	require.NoError(t, err)
+
+	_, err = network.invoke(t, user, "RespondToDispute", dispute.DisputeID, "the rows match", "")
+	require.EqualError(t, err, fmt.Sprintf("the client who raised dispute %s cannot respond to it", dispute.DisputeID))
+	_, err = network.invoke(t, other, "RespondToDispute", dispute.DisputeID, "the rows match", "")
+	require.EqualError(t, err, fmt.Sprintf("only the provider of service %s may respond to dispute %s", testServiceID, dispute.DisputeID))
+
+	payload, err := network.invoke(t, provider, "RespondToDispute", dispute.DisputeID, "the rows match", testEvidenceDigest)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(payload, dispute))
+	require.Equal(t, disputeResponded, dispute.Status)
+	require.Equal(t, provider.id(t), dispute.Responses[0].ResponderID)
+}
+
+// A dispute raised by the provider is answered by the initiator
+func TestRespondToProviderDisputeOnlyByInitiator(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	other := network.ca.enroll(t, "user2", "client", nil)
+	provider := network.ca.enroll(t, "provider", "client", nil)
+	provider.mspID = testProviderMSPID
+	otherProvider := network.ca.enroll(t, "provider2", "client", nil)
+	otherProvider.mspID = testProviderMSPID
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+
+	dispute, err := raiseDispute(t, network, provider, "query1")
+	require.NoError(t, err)
+
+	_, err = network.invoke(t, otherProvider, "RespondToDispute", dispute.DisputeID, "the query was legitimate", "")
+	require.EqualError(t, err, fmt.Sprintf("only the initiator of query query1 may respond to dispute %s", dispute.DisputeID))
+	_, err = network.invoke(t, other, "RespondToDispute", dispute.DisputeID, "the query was legitimate", "")
+	require.EqualError(t, err, fmt.Sprintf("only the initiator of query query1 may respond to dispute %s", dispute.DisputeID))
+
+	payload, err := network.invoke(t, user, "RespondToDispute", dispute.DisputeID, "the query was legitimate", "")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(payload, dispute))
+	require.Equal(t, disputeResponded, dispute.Status)
+	require.Equal(t, user.id(t), dispute.Responses[0].ResponderID)
+}
+
+func TestRespondToDisputeBySubmittingServiceClient(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	serviceClient := network.ca.enroll(t, "service", "client", map[string]string{roleAttribute: serviceClientRole})
+	otherServiceClient := network.ca.enroll(t, "service2", "client", map[string]string{roleAttribute: serviceClientRole})
+
+	network.mustInvoke(t, user, "GrantDelegation", testMSPID, serviceClient.id(t), "0")
+	detailsBytes, err := json.Marshal(user.details(t, "query1", "SELECT * FROM "+testTable))
+	require.NoError(t, err)
+	_, err = network.invokeWithTransient(t, serviceClient, map[string][]byte{transientQueryKey: detailsBytes},
+		"CreateQueryOnBehalfOf", testDataDigest, "3", "0", user.id(t), testMSPID, "query1", testServiceID)
+	require.NoError(t, err)
+
+	// The service client that logged the query provides the service, so it may dispute it too
+	_, err = raiseDispute(t, network, otherServiceClient, "query1")
+	require.Error(t, err)
+	_, err = raiseDispute(t, network, serviceClient, "query1")
+	require.NoError(t, err)
+	dispute, err := raiseDispute(t, network, user, "query1")
+	require.NoError(t, err)
+
+	_, err = network.invoke(t, otherServiceClient, "RespondToDispute", dispute.DisputeID, "the rows match", "")
+	require.Error(t, err)
+	network.mustInvoke(t, serviceClient, "RespondToDispute", dispute.DisputeID, "the rows match", "")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// QueryHistoryRecord is one version of a query record together with the transaction that wrote it
+type QueryHistoryRecord struct {
+	IsDelete  bool   `json:"IsDelete"`
+	Record    *Query `json:"Record" metadata:",optional"`
+	Timestamp int    `json:"Timestamp"`
+	TxID      string `json:"TxID"`
+}
+
+// GetQueryHistory returns every version of a query, oldest first.
+// The first entry is the transaction that created the query. A query moved by MigrateQueryKeys
+// starts with the versions written under its legacy key, up to its deletion by the move.
+func (s *QuerySmartContract) GetQueryHistory(ctx contractapi.TransactionContextInterface, queryID string) ([]*QueryHistoryRecord, error) {
+	records, err := readQueryHistory(ctx, queryID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := queryKey(ctx, queryID)
+	if err != nil {
+		return nil, err
+	}
+
+	migratedRecords, err := readQueryHistory(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// A record only ever moves from its legacy key to its composite key, so the legacy versions come first
+	return append(records, migratedRecords...), nil
+}
+
+// readQueryHistory returns every version written under a key of a query record, oldest first
+func readQueryHistory(ctx contractapi.TransactionContextInterface, key string) ([]*QueryHistoryRecord, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetHistoryForKey %s: %v", key, err)
+	}
+	defer resultsIterator.Close()
+
+	var records []*QueryHistoryRecord
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// A deleted key has no value
+		var query *Query
+		if len(response.Value) > 0 {
+			query = new(Query)
+			err = json.Unmarshal(response.Value, query)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		records = append(records, &QueryHistoryRecord{
+			IsDelete:  response.IsDelete,
+			Record:    query,
+			Timestamp: int(response.Timestamp.GetSeconds()),
+			TxID:      response.TxId,
+		})
+	}
+
+	// The history is returned newest first, reverse it to read as a trail
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	return records, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// queryHistory reads the history of a query as the client
+func (n *testNetwork) queryHistory(t *testing.T, client *testClient, queryID string) []*QueryHistoryRecord {
+	var records []*QueryHistoryRecord
+	require.NoError(t, json.Unmarshal(n.mustInvoke(t, client, "GetQueryHistory", queryID), &records))
+	return records
+}
+
+func TestGetQueryHistory(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	auditor := network.ca.enroll(t, "auditor", "client", map[string]string{auditorAttribute: "true"})
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+	network.mustInvoke(t, auditor, "ReviewQuery", "query1", legitimacyApproved, "looks fine")
+
+	records := network.queryHistory(t, user, "query1")
+	require.Len(t, records, 2)
+	require.Equal(t, legitimacyPending, records[0].Record.Legitimacy)
+	require.Equal(t, legitimacyApproved, records[1].Record.Legitimacy)
+	require.NotEqual(t, records[0].TxID, records[1].TxID)
+}
+
+// A migrated query keeps the versions written under its legacy key
+func TestGetQueryHistoryMergesLegacyKey(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	auditor := network.ca.enroll(t, "auditor", "client", map[string]string{auditorAttribute: "true"})
+
+	network.stub.MockTransactionStart("legacy")
+	legacyBytes := []byte(`{"Certificate":"cert","DataDigest":"digest","DatatRows":3,"InitiatorID":"initiator","InitiatorMSPID":"Org1MSP","Legitimacy":"legal","QueriedTable":"table","QueryDigest":"select","QueryID":"query1","ServiceID":"service1","Timestamp":1000}`)
+	require.NoError(t, network.stub.PutState("query1", legacyBytes))
+	network.stub.MockTransactionEnd("legacy")
+
+	network.mustInvoke(t, network.admin, "MigrateQueryKeys", "10")
+	network.mustInvoke(t, auditor, "ReviewQuery", "query1", legitimacyApproved, "looks fine")
+
+	records := network.queryHistory(t, user, "query1")
+	require.Len(t, records, 4)
+	require.Equal(t, "legacy", records[0].TxID)
+	require.Equal(t, "legal", records[0].Record.Legitimacy)
+	require.True(t, records[1].IsDelete)
+	require.Nil(t, records[1].Record)
+	require.Equal(t, records[1].TxID, records[2].TxID)
+	require.Equal(t, legitimacyPending, records[2].Record.Legitimacy)
+	require.Equal(t, legitimacyApproved, records[3].Record.Legitimacy)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType name for delegations granted by end users to service clients
+const delegationPrefix = "delegation"
+
+// Service clients that submit queries on behalf of end users carry this certificate attribute
+const roleAttribute = "role"
+const serviceClientRole = "service"
+
+// Delegation allows a service client (the delegate) to log queries on behalf of an end user (the delegator)
+type Delegation struct {
+	DelegateID     string `json:"DelegateID"`
+	DelegateMSPID  string `json:"DelegateMSPID"`
+	DelegatorID    string `json:"DelegatorID"`
+	DelegatorMSPID string `json:"DelegatorMSPID"`
+	GrantedAt      int    `json:"GrantedAt"`
+	Revoked        bool   `json:"Revoked"`
+	ValidUntil     int    `json:"ValidUntil"`
+}
+
+// getClientIdentity returns the decoded identity of the submitting client,
+// in the same format as the accounts of the service chaincode.
+func getClientIdentity(ctx contractapi.TransactionContextInterface) (string, error) {
+	id64, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	idBytes, err := base64.StdEncoding.DecodeString(id64)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode client identity: %v", err)
+	}
+
+	return strings.ReplaceAll(string(idBytes), " ", ""), nil
+}
+
+// getTxTimestamp returns the transaction timestamp in unix seconds
+func getTxTimestamp(ctx contractapi.TransactionContextInterface) (int, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to GetTxTimestamp: %v", err)
+	}
+
+	return int(txTimestamp.GetSeconds()), nil
+}
+
+// GrantDelegation allows a service client to log queries on behalf of the submitting client.
+// A validUntil of 0 keeps the delegation valid until it is revoked.
+func (s *QuerySmartContract) GrantDelegation(ctx contractapi.TransactionContextInterface, delegateMSPID string, delegateID string, validUntil int) (*Delegation, error) {
+	delegatorID, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	delegatorMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+
+	now, err := getTxTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if validUntil != 0 && validUntil <= now {
+		return nil, fmt.Errorf("the delegation would already be expired at %d", validUntil)
+	}
+
+	delegation := &Delegation{
+		DelegateID:     delegateID,
+		DelegateMSPID:  delegateMSPID,
+		DelegatorID:    delegatorID,
+		DelegatorMSPID: delegatorMSPID,
+		GrantedAt:      now,
+		ValidUntil:     validUntil,
+	}
+
+	return delegation, putDelegation(ctx, delegation)
+}
+
+// RevokeDelegation withdraws a delegation previously granted by the submitting client
+func (s *QuerySmartContract) RevokeDelegation(ctx contractapi.TransactionContextInterface, delegateMSPID string, delegateID string) (*Delegation, error) {
+	delegatorID, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	delegatorMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+
+	delegation, err := s.ReadDelegation(ctx, delegatorMSPID, delegatorID, delegateMSPID, delegateID)
+	if err != nil {
+		return nil, err
+	}
+
+	delegation.Revoked = true
+	return delegation, putDelegation(ctx, delegation)
+}
+
+// ReadDelegation returns the delegation from a delegator to a delegate
+func (s *QuerySmartContract) ReadDelegation(ctx contractapi.TransactionContextInterface, delegatorMSPID string, delegatorID string, delegateMSPID string, delegateID string) (*Delegation, error) {
+	delegationKey, err := ctx.GetStub().CreateCompositeKey(delegationPrefix, []string{delegatorMSPID, delegatorID, delegateMSPID, delegateID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", delegationPrefix, err)
+	}
+
+	delegationBytes, err := ctx.GetStub().GetState(delegationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if delegationBytes == nil {
+		return nil, fmt.Errorf("%s has not delegated to %s", delegatorID, delegateID)
+	}
+
+	var delegation Delegation
+	err = json.Unmarshal(delegationBytes, &delegation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &delegation, nil
+}
+
+// CreateQueryOnBehalfOf lets a service client log a query for an end user who has delegated to it.
+// The submitter must carry the role=service certificate attribute and an active delegation from the initiator.
+// Private details are passed in the transient map as for CreateQuery.
+func (s *QuerySmartContract) CreateQueryOnBehalfOf(ctx contractapi.TransactionContextInterface, dataDigest string, dataRows int, epsilon float64, initiatorID, initiatorMSPID, queryID, serviceID string) error {
+	details, err := getQueryTransientInput(ctx)
+	if err != nil {
+		return err
+	}
+
+	submitterID, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	submitterMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+
+	err = s.checkDelegation(ctx, initiatorMSPID, initiatorID, submitterMSPID, submitterID)
+	if err != nil {
+		return err
+	}
+
+	query := Query{
+		DataDigest:     dataDigest,
+		DataRows:       dataRows,
+		Epsilon:        epsilon,
+		InitiatorID:    initiatorID,
+		InitiatorMSPID: initiatorMSPID,
+		QueryID:        queryID,
+		ServiceID:      serviceID,
+		SubmitterID:    submitterID,
+		SubmitterMSPID: submitterMSPID,
+	}
+
+	return s.putQuery(ctx, &query, details)
+}
+
+// checkDelegation checks that the initiator has delegated to the submitter and that the delegation is still active
+func (s *QuerySmartContract) checkDelegation(ctx contractapi.TransactionContextInterface, initiatorMSPID string, initiatorID string, submitterMSPID string, submitterID string) error {
+	delegation, err := s.ReadDelegation(ctx, initiatorMSPID, initiatorID, submitterMSPID, submitterID)
+	if err != nil {
+		return err
+	}
+	if delegation.Revoked {
+		return fmt.Errorf("the delegation from %s to %s has been revoked", initiatorID, submitterID)
+	}
+
+	now, err := getTxTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if delegation.ValidUntil != 0 && delegation.ValidUntil < now {
+		return fmt.Errorf("the delegation from %s to %s expired at %d", initiatorID, submitterID, delegation.ValidUntil)
+	}
+
+	return nil
+}
+
+// putDelegation stores a delegation and emits the Delegation event
+func putDelegation(ctx contractapi.TransactionContextInterface, delegation *Delegation) error {
+	delegationKey, err := ctx.GetStub().CreateCompositeKey(delegationPrefix, []string{delegation.DelegatorMSPID, delegation.DelegatorID, delegation.DelegateMSPID, delegation.DelegateID})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", delegationPrefix, err)
+	}
+
+	delegationBytes, err := json.Marshal(delegation)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(delegationKey, delegationBytes)
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", delegationKey, err)
+	}
+
+	err = ctx.GetStub().SetEvent("Delegation", delegationBytes)
+	if err != nil {
+		return fmt.Errorf("failed to SetEvent Delegation: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// createQueryOnBehalfOf logs a query of the initiator against testServiceID, submitted by a service client
+func (n *testNetwork) createQueryOnBehalfOf(t *testing.T, submitter *testClient, initiator *testClient, queryID string) error {
+	detailsBytes, err := json.Marshal(initiator.details(t, queryID, "SELECT * FROM "+testTable))
+	require.NoError(t, err)
+
+	_, err = n.invokeWithTransient(t, submitter, map[string][]byte{transientQueryKey: detailsBytes},
+		"CreateQueryOnBehalfOf", testDataDigest, "3", "0", initiator.id(t), initiator.mspID, queryID, testServiceID)
+	return err
+}
+
+func TestCreateQueryDerivesInitiatorAndTimestamp(t *testing.T) {
+	network := newTestNetwork(t)
+	now := time.Now().Add(-time.Minute)
+	network.stub.now = now
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+
+	query := network.readQuery(t, "query1")
+	require.Equal(t, user.id(t), query.InitiatorID)
+	require.Equal(t, testMSPID, query.InitiatorMSPID)
+	require.Equal(t, user.id(t), query.SubmitterID)
+	require.Equal(t, testMSPID, query.SubmitterMSPID)
+	require.Equal(t, int(now.Unix()), query.Timestamp)
+}
+
+func TestCreateQueryOnBehalfOf(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	serviceClient := network.ca.enroll(t, "service", "client", map[string]string{roleAttribute: serviceClientRole})
+	plainClient := network.ca.enroll(t, "user2", "client", nil)
+
+	err := network.createQueryOnBehalfOf(t, serviceClient, user, "query1")
+	require.EqualError(t, err, fmt.Sprintf("%s has not delegated to %s", user.id(t), serviceClient.id(t)))
+
+	network.mustInvoke(t, user, "GrantDelegation", testMSPID, serviceClient.id(t), "0")
+	network.mustInvoke(t, user, "GrantDelegation", testMSPID, plainClient.id(t), "0")
+
+	// A delegation is not enough without the service role
+	require.Error(t, network.createQueryOnBehalfOf(t, plainClient, user, "query1"))
+
+	require.NoError(t, network.createQueryOnBehalfOf(t, serviceClient, user, "query1"))
+	query := network.readQuery(t, "query1")
+	require.Equal(t, user.id(t), query.InitiatorID)
+	require.Equal(t, testMSPID, query.InitiatorMSPID)
+	require.Equal(t, serviceClient.id(t), query.SubmitterID)
+
+	network.mustInvoke(t, user, "RevokeDelegation", testMSPID, serviceClient.id(t))
+	err = network.createQueryOnBehalfOf(t, serviceClient, user, "query2")
+	require.EqualError(t, err, fmt.Sprintf("the delegation from %s to %s has been revoked", user.id(t), serviceClient.id(t)))
+}
+
+func TestDelegationExpires(t *testing.T) {
+	network := newTestNetwork(t)
+	now := time.Now()
+	network.stub.now = now
+	user := network.ca.enroll(t, "user1", "client", nil)
+	serviceClient := network.ca.enroll(t, "service", "client", map[string]string{roleAttribute: serviceClientRole})
+
+	validUntil := now.Add(time.Minute).Unix()
+	_, err := network.invoke(t, user, "GrantDelegation", testMSPID, serviceClient.id(t), fmt.Sprint(now.Unix()))
+	require.EqualError(t, err, fmt.Sprintf("the delegation would already be expired at %d", now.Unix()))
+	network.mustInvoke(t, user, "GrantDelegation", testMSPID, serviceClient.id(t), fmt.Sprint(validUntil))
+
+	require.NoError(t, network.createQueryOnBehalfOf(t, serviceClient, user, "query1"))
+
+	network.stub.now = now.Add(2 * time.Minute)
+	err = network.createQueryOnBehalfOf(t, serviceClient, user, "query2")
+	require.EqualError(t, err, fmt.Sprintf("the delegation from %s to %s expired at %d", user.id(t), serviceClient.id(t), validUntil))
+}
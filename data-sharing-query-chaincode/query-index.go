@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// queryDocType marks Query documents so that CouchDB selectors only match query records
+const queryDocType = "query"
+
+// Define objectType name for query records. Every other kind of state lives under its own
+// objectType, so a scan of this one only ever returns queries.
+const queryPrefix = "query"
+
+// Define objectType names for the composite-key indexes written by CreateQuery.
+// Every index key ends with the queryID, which points back to the query record.
+// Entries of the sequence index hold a QueryChainLink with the record as it was linked into the hash chain.
+// The table index is kept in the private data collection of the initiator's org, next to the table name.
+const serviceIndex = "service~query"
+const initiatorIndex = "initiator~query"
+const tableIndex = "table~query"
+const timestampIndex = "timestamp~query"
+const legitimacyIndex = "legitimacy~query"
+const sequenceIndex = "sequence~query"
+
+// Names of the CouchDB index definitions shipped in META-INF/statedb/couchdb/indexes
+const serviceIndexDoc = "indexServiceDoc"
+const initiatorIndexDoc = "indexInitiatorDoc"
+const timestampIndexDoc = "indexTimestampDoc"
+const legitimacyIndexDoc = "indexLegitimacyDoc"
+
+// formatTimestamp left-pads a timestamp so that composite keys sort in chronological order.
+// The order only holds for timestamps that are not negative.
+func formatTimestamp(timestamp int) string {
+	return fmt.Sprintf("%020d", timestamp)
+}
+
+// checkTimeRange rejects time ranges that the timestamp index cannot answer
+func checkTimeRange(startTimestamp int, endTimestamp int) error {
+	if startTimestamp < 0 || endTimestamp < 0 {
+		return fmt.Errorf("timestamps must not be negative, got %d and %d", startTimestamp, endTimestamp)
+	}
+	if startTimestamp > endTimestamp {
+		return fmt.Errorf("start timestamp %d is after end timestamp %d", startTimestamp, endTimestamp)
+	}
+
+	return nil
+}
+
+// formatSequence left-pads a sequence number so that composite keys sort in chain order
+func formatSequence(sequence int) string {
+	return fmt.Sprintf("%020d", sequence)
+}
+
+// queryKey returns the world state key of the query record with given id
+func queryKey(ctx contractapi.TransactionContextInterface, queryID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(queryPrefix, []string{queryID})
+	if err != nil {
+		return "", fmt.Errorf("failed to CreateCompositeKey %s: %v", queryPrefix, err)
+	}
+
+	return key, nil
+}
+
+// queryIndex is one composite-key index entry of a query
+type queryIndex struct {
+	objectType string
+	attributes []string
+}
+
+// queryIndexKeys returns the composite keys under which a query is indexed
+func queryIndexKeys(ctx contractapi.TransactionContextInterface, query *Query) ([]string, error) {
+	indexes := []queryIndex{
+		{serviceIndex, []string{query.ServiceID, query.QueryID}},
+		{initiatorIndex, []string{query.InitiatorMSPID, query.InitiatorID, query.QueryID}},
+		{timestampIndex, []string{formatTimestamp(query.Timestamp), query.QueryID}},
+		{legitimacyIndex, []string{query.Legitimacy, query.QueryID}},
+	}
+
+	var keys []string
+	for _, index := range indexes {
+		key, err := ctx.GetStub().CreateCompositeKey(index.objectType, index.attributes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", index.objectType, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// putQueryIndexes writes every composite-key index entry of a query.
+// An empty value would represent a delete, so we simply insert the null character.
+func putQueryIndexes(ctx contractapi.TransactionContextInterface, query *Query) error {
+	keys, err := queryIndexKeys(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		err = ctx.GetStub().PutState(key, []byte{0x00})
+		if err != nil {
+			return fmt.Errorf("failed to PutState index %s: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// GetQueriesByService returns all queries issued against the given service
+func (s *QuerySmartContract) GetQueriesByService(ctx contractapi.TransactionContextInterface, serviceID string) ([]*Query, error) {
+	selector := map[string]interface{}{
+		"DocType":   queryDocType,
+		"ServiceID": serviceID,
+	}
+	return s.getQuerysByIndex(ctx, selector, serviceIndexDoc, serviceIndex, []string{serviceID})
+}
+
+// GetQueriesByInitiator returns all queries issued by the given initiator.
+// An empty initiatorID returns the queries of every initiator in initiatorMSPID.
+func (s *QuerySmartContract) GetQueriesByInitiator(ctx contractapi.TransactionContextInterface, initiatorMSPID string, initiatorID string) ([]*Query, error) {
+	selector := map[string]interface{}{
+		"DocType":        queryDocType,
+		"InitiatorMSPID": initiatorMSPID,
+	}
+	attributes := []string{initiatorMSPID}
+	if initiatorID != "" {
+		selector["InitiatorID"] = initiatorID
+		attributes = append(attributes, initiatorID)
+	}
+	return s.getQuerysByIndex(ctx, selector, initiatorIndexDoc, initiatorIndex, attributes)
+}
+
+// GetQueriesByTable returns the queries of the client's org that read the given table.
+// Table names are only kept in private data, so the lookup goes through the table index in the
+// collection of the client's org, and only clients of that org may call it, on a peer of that org.
+func (s *QuerySmartContract) GetQueriesByTable(ctx contractapi.TransactionContextInterface, queriedTable string) ([]*Query, error) {
+	collection, err := clientCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, tableIndex, []string{queriedTable})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetPrivateDataByPartialCompositeKey %s: %v", tableIndex, err)
+	}
+	defer iterator.Close()
+
+	return s.readQuerysFromIndexIterator(ctx, iterator)
+}
+
+// GetQueriesInTimeRange returns all queries whose timestamp lies in [startTimestamp, endTimestamp]
+func (s *QuerySmartContract) GetQueriesInTimeRange(ctx contractapi.TransactionContextInterface, startTimestamp int, endTimestamp int) ([]*Query, error) {
+	err := checkTimeRange(startTimestamp, endTimestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := map[string]interface{}{
+		"DocType": queryDocType,
+		"Timestamp": map[string]interface{}{
+			"$gte": startTimestamp,
+			"$lte": endTimestamp,
+		},
+	}
+	richQueries, err := richQueriesEnabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if richQueries {
+		return s.getQuerysBySelector(ctx, selector, timestampIndexDoc)
+	}
+
+	// The state database does not support rich queries, so walk the timestamp index,
+	// which is sorted chronologically, and stop once we pass endTimestamp.
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(timestampIndex, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKey %s: %v", timestampIndex, err)
+	}
+	defer iterator.Close()
+
+	start := formatTimestamp(startTimestamp)
+	end := formatTimestamp(endTimestamp)
+	var querys []*Query
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to SplitCompositeKey %s: %v", response.Key, err)
+		}
+
+		timestamp := compositeKeyParts[0]
+		if timestamp < start {
+			continue
+		}
+		if timestamp > end {
+			break
+		}
+
+		query, err := s.ReadQuery(ctx, compositeKeyParts[len(compositeKeyParts)-1])
+		if err != nil {
+			return nil, err
+		}
+		querys = append(querys, query)
+	}
+
+	return querys, nil
+}
+
+// getQuerysByIndex answers a filtered query with a CouchDB selector, or with the composite-key index
+// when the contract is configured for a state database without rich query support (LevelDB).
+func (s *QuerySmartContract) getQuerysByIndex(ctx contractapi.TransactionContextInterface, selector map[string]interface{}, indexDoc string, objectType string, attributes []string) ([]*Query, error) {
+	richQueries, err := richQueriesEnabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if richQueries {
+		return s.getQuerysBySelector(ctx, selector, indexDoc)
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKey %s: %v", objectType, err)
+	}
+	defer iterator.Close()
+
+	return s.readQuerysFromIndexIterator(ctx, iterator)
+}
+
+// readQuerysFromIndexIterator resolves every composite index key returned by an iterator to its query
+func (s *QuerySmartContract) readQuerysFromIndexIterator(ctx contractapi.TransactionContextInterface, iterator shim.StateQueryIteratorInterface) ([]*Query, error) {
+	var querys []*Query
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to SplitCompositeKey %s: %v", response.Key, err)
+		}
+
+		query, err := s.ReadQuery(ctx, compositeKeyParts[len(compositeKeyParts)-1])
+		if err != nil {
+			return nil, err
+		}
+		querys = append(querys, query)
+	}
+
+	return querys, nil
+}
+
+// getQuerysBySelector runs a CouchDB rich query. It returns an error on LevelDB.
+func (s *QuerySmartContract) getQuerysBySelector(ctx contractapi.TransactionContextInterface, selector map[string]interface{}, indexDoc string) ([]*Query, error) {
+	queryString, err := json.Marshal(map[string]interface{}{
+		"selector":  selector,
+		"use_index": []string{"_design/" + indexDoc},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal selector: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run rich query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	return constructQuerysFromIterator(resultsIterator)
+}
+
+// constructQuerysFromIterator unmarshals every record returned by a state iterator
+func constructQuerysFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*Query, error) {
+	var querys []*Query
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var query Query
+		err = json.Unmarshal(queryResponse.Value, &query)
+		if err != nil {
+			return nil, err
+		}
+		querys = append(querys, &query)
+	}
+
+	return querys, nil
+}
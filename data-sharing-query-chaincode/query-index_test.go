@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// queryIDs returns the ids of the queries of a lookup in the order they were returned
+func queryIDs(t *testing.T, querysBytes []byte) []string {
+	ids := []string{}
+	if len(querysBytes) == 0 {
+		return ids
+	}
+
+	var querys []*Query
+	require.NoError(t, json.Unmarshal(querysBytes, &querys))
+
+	for _, query := range querys {
+		ids = append(ids, query.QueryID)
+	}
+	return ids
+}
+
+// The filtered lookups answer the same on both state databases
+func TestFilteredLookups(t *testing.T) {
+	for _, couchDB := range []bool{false, true} {
+		t.Run(fmt.Sprintf("couchDB=%v", couchDB), func(t *testing.T) {
+			network := newTestNetworkOn(t, couchDB)
+			user1 := network.ca.enroll(t, "user1", "client", nil)
+			user2 := network.ca.enroll(t, "user2", "client", nil)
+			require.NoError(t, network.createQuery(t, user1, "query1", 1))
+			require.NoError(t, network.createQuery(t, user2, "query2", 2))
+			require.NoError(t, network.createQuery(t, user1, "query3", 3))
+
+			ids := queryIDs(t, network.mustInvoke(t, user1, "GetQueriesByService", testServiceID))
+			require.ElementsMatch(t, []string{"query1", "query2", "query3"}, ids)
+			ids = queryIDs(t, network.mustInvoke(t, user1, "GetQueriesByService", "service2"))
+			require.Empty(t, ids)
+
+			ids = queryIDs(t, network.mustInvoke(t, user1, "GetQueriesByInitiator", testMSPID, user1.id(t)))
+			require.ElementsMatch(t, []string{"query1", "query3"}, ids)
+			ids = queryIDs(t, network.mustInvoke(t, user1, "GetQueriesByInitiator", "Org2MSP", user1.id(t)))
+			require.Empty(t, ids)
+
+			ids = queryIDs(t, network.mustInvoke(t, user1, "GetQueriesByTable", testTable))
+			require.ElementsMatch(t, []string{"query1", "query2", "query3"}, ids)
+			ids = queryIDs(t, network.mustInvoke(t, user1, "GetQueriesByTable", "other_table"))
+			require.Empty(t, ids)
+
+			now := time.Now().Unix()
+			ids = queryIDs(t, network.mustInvoke(t, user1, "GetQueriesInTimeRange", fmt.Sprint(now-60), fmt.Sprint(now+60)))
+			require.ElementsMatch(t, []string{"query1", "query2", "query3"}, ids)
+			ids = queryIDs(t, network.mustInvoke(t, user1, "GetQueriesInTimeRange", "0", fmt.Sprint(now-60)))
+			require.Empty(t, ids)
+		})
+	}
+}
+
+func TestSetStateDatabase(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	require.Equal(t, stateDatabaseLevelDB, string(network.mustInvoke(t, user, "StateDatabase")))
+
+	_, err := network.invoke(t, network.admin, "SetStateDatabase", "mongodb")
+	require.EqualError(t, err, `state database must be leveldb or couchdb, got "mongodb"`)
+
+	network.mustInvoke(t, network.admin, "SetStateDatabase", stateDatabaseCouchDB)
+	require.Equal(t, stateDatabaseCouchDB, string(network.mustInvoke(t, user, "StateDatabase")))
+
+	// The mock stub of a LevelDB network has no query engine, so lookups now fail rather than fall back
+	_, err = network.invoke(t, user, "GetQueriesByService", testServiceID)
+	require.Error(t, err)
+}
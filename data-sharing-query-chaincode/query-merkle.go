@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/merkle"
+)
+
+// VerifyRowInclusion checks that a result row was part of the data returned for a query.
+// The query's DataDigest must be the hex encoded Merkle root computed by the merkle package
+// and the proof must cover exactly DataRows rows.
+func (s *QuerySmartContract) VerifyRowInclusion(ctx contractapi.TransactionContextInterface, queryID string, row []string, proof merkle.Proof) (bool, error) {
+	query, err := s.ReadQuery(ctx, queryID)
+	if err != nil {
+		return false, err
+	}
+
+	root, err := hex.DecodeString(query.DataDigest)
+	if err != nil {
+		return false, fmt.Errorf("the DataDigest of query %s is not a hex encoded Merkle root: %v", queryID, err)
+	}
+
+	if proof.Size != query.DataRows {
+		return false, fmt.Errorf("the proof covers %d rows but query %s returned %d", proof.Size, queryID, query.DataRows)
+	}
+
+	err = merkle.Verify(root, row, &proof)
+	if err != nil {
+		return false, nil
+	}
+
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// legacyQuery is a query record stored at its raw queryID by earlier versions of the contract.
+// The first version kept the private fields in plain text in world state.
+type legacyQuery struct {
+	Query
+	Certificate  string `json:"Certificate"`
+	QueriedTable string `json:"QueriedTable"`
+	QueryDigest  string `json:"QueryDigest"`
+}
+
+// MigrateQueryKeys moves up to limit query records from their raw queryID key to the query objectType,
+// indexes them, and moves plain text private fields into the initiator's private data collection.
+// Only the contract owner may call it. It returns the number of queries moved; call it until that is 0.
+func (s *QuerySmartContract) MigrateQueryKeys(ctx contractapi.TransactionContextInterface, limit int) (int, error) {
+	err := assertOwner(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 {
+		return 0, fmt.Errorf("limit must be positive")
+	}
+
+	// A range scan only returns simple keys, which earlier versions used for query records only
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for migrated < limit && resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return migrated, err
+		}
+		if strings.HasPrefix(queryResponse.Key, "\x00") {
+			continue
+		}
+
+		err = migrateQuery(ctx, queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// readLegacyQuery returns the query stored at its raw queryID, or nil if there is none
+func readLegacyQuery(ctx contractapi.TransactionContextInterface, queryID string) (*legacyQuery, error) {
+	legacyBytes, err := ctx.GetStub().GetState(queryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if legacyBytes == nil {
+		return nil, nil
+	}
+
+	var legacy legacyQuery
+	err = json.Unmarshal(legacyBytes, &legacy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal query %s: %v", queryID, err)
+	}
+
+	return &legacy, nil
+}
+
+// migrateQuery rewrites one legacy query record under its new key
+func migrateQuery(ctx contractapi.TransactionContextInterface, legacyKey string, legacyBytes []byte) error {
+	var legacy legacyQuery
+	err := json.Unmarshal(legacyBytes, &legacy)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal query %s: %v", legacyKey, err)
+	}
+
+	query := legacy.Query
+	query.DocType = queryDocType
+	// Earlier versions took the legitimacy from the client, anything but a review state goes back to review
+	switch query.Legitimacy {
+	case legitimacyPending, legitimacyApproved, legitimacyRejected, legitimacyEscalated:
+	default:
+		query.Legitimacy = legitimacyPending
+	}
+
+	if legacy.Certificate != "" || legacy.QueriedTable != "" || legacy.QueryDigest != "" {
+		// The legacy fields stay readable in the history of the ledger whatever the salt,
+		// so the transaction ID serves as one
+		salt := ctx.GetStub().GetTxID()
+		query.CertificateHash = hashPrivateField(salt, legacy.Certificate)
+		query.QueriedTableHash = hashPrivateField(salt, legacy.QueriedTable)
+		query.QueryDigestHash = hashPrivateField(salt, legacy.QueryDigest)
+
+		err = putQueryPrivateDetails(ctx, query.InitiatorMSPID, &QueryPrivateDetails{
+			Certificate:  legacy.Certificate,
+			QueriedTable: legacy.QueriedTable,
+			QueryDigest:  legacy.QueryDigest,
+			QueryID:      query.QueryID,
+			Salt:         salt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return err
+	}
+
+	key, err := queryKey(ctx, query.QueryID)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, queryBytes)
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", query.QueryID, err)
+	}
+
+	err = putQueryIndexes(ctx, &query)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(legacyKey)
+	if err != nil {
+		return fmt.Errorf("failed to DelState %s: %v", legacyKey, err)
+	}
+
+	return nil
+}
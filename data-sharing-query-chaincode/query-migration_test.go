@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadQueryFallsBackToLegacyKey(t *testing.T) {
+	ctx, stub := newTestContext()
+	legacyBytes := []byte(`{"Certificate":"cert","DataDigest":"digest","DatatRows":3,"InitiatorID":"initiator","InitiatorMSPID":"Org1MSP","Legitimacy":"legal","QueriedTable":"table","QueryDigest":"select","QueryID":"query1","ServiceID":"service1","Timestamp":1000}`)
+	require.NoError(t, stub.PutState("query1", legacyBytes))
+	contract := new(QuerySmartContract)
+
+	exists, err := contract.QueryExists(ctx, "query1")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	query, err := contract.ReadQuery(ctx, "query1")
+	require.NoError(t, err)
+	require.Equal(t, "query1", query.QueryID)
+	require.Equal(t, 3, query.DataRows)
+	require.Equal(t, "service1", query.ServiceID)
+
+	_, err = contract.ReviewQuery(ctx, "query1", legitimacyApproved, "looks fine")
+	require.ErrorContains(t, err, "MigrateQueryKeys")
+
+	_, err = contract.ReadQuery(ctx, "query2")
+	require.EqualError(t, err, "the query query2 does not exist")
+}
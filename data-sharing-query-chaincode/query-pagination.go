@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PaginatedQueryResult is one page of querys plus the bookmark to fetch the next page.
+// An empty Bookmark means there are no more pages. FetchedRecordsCount is the number of
+// records the state database read for the page, which may exceed the number of Records
+// when the page is filtered after reading.
+type PaginatedQueryResult struct {
+	Bookmark            string   `json:"Bookmark"`
+	FetchedRecordsCount int32    `json:"FetchedRecordsCount"`
+	Records             []*Query `json:"Records"`
+}
+
+// GetAllQuerysWithPagination returns one page of the querys found in world state
+func (s *QuerySmartContract) GetAllQuerysWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(queryPrefix, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	querys, err := constructQuerysFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPaginatedQueryResult(querys, responseMetadata.FetchedRecordsCount, responseMetadata.Bookmark), nil
+}
+
+// GetQueriesByServiceWithPagination returns one page of the queries issued against the given service
+func (s *QuerySmartContract) GetQueriesByServiceWithPagination(ctx contractapi.TransactionContextInterface, serviceID string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	selector := map[string]interface{}{
+		"DocType":   queryDocType,
+		"ServiceID": serviceID,
+	}
+	return s.getQuerysByIndexWithPagination(ctx, selector, serviceIndexDoc, serviceIndex, []string{serviceID}, pageSize, bookmark)
+}
+
+// GetQueriesByInitiatorWithPagination returns one page of the queries issued by the given initiator.
+// An empty initiatorID pages through every initiator in initiatorMSPID.
+func (s *QuerySmartContract) GetQueriesByInitiatorWithPagination(ctx contractapi.TransactionContextInterface, initiatorMSPID string, initiatorID string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	selector := map[string]interface{}{
+		"DocType":        queryDocType,
+		"InitiatorMSPID": initiatorMSPID,
+	}
+	attributes := []string{initiatorMSPID}
+	if initiatorID != "" {
+		selector["InitiatorID"] = initiatorID
+		attributes = append(attributes, initiatorID)
+	}
+	return s.getQuerysByIndexWithPagination(ctx, selector, initiatorIndexDoc, initiatorIndex, attributes, pageSize, bookmark)
+}
+
+// GetQueriesByTableWithPagination returns one page of the queries of the client's org that read the given table.
+// Private data cannot be read by page, so the page is cut from the table index in the collection of the client's org,
+// and the bookmark is the index key the next page starts at.
+func (s *QuerySmartContract) GetQueriesByTableWithPagination(ctx contractapi.TransactionContextInterface, queriedTable string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	collection, err := clientCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, tableIndex, []string{queriedTable})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetPrivateDataByPartialCompositeKey %s: %v", tableIndex, err)
+	}
+	defer iterator.Close()
+
+	querys := []*Query{}
+	nextBookmark := ""
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if response.Key < bookmark {
+			continue
+		}
+		if len(querys) == int(pageSize) {
+			nextBookmark = response.Key
+			break
+		}
+
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to SplitCompositeKey %s: %v", response.Key, err)
+		}
+
+		query, err := s.ReadQuery(ctx, compositeKeyParts[len(compositeKeyParts)-1])
+		if err != nil {
+			return nil, err
+		}
+		querys = append(querys, query)
+	}
+
+	return newPaginatedQueryResult(querys, int32(len(querys)), nextBookmark), nil
+}
+
+// GetQueriesInTimeRangeWithPagination returns one page of the queries whose timestamp lies in [startTimestamp, endTimestamp]
+func (s *QuerySmartContract) GetQueriesInTimeRangeWithPagination(ctx contractapi.TransactionContextInterface, startTimestamp int, endTimestamp int, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	err := checkTimeRange(startTimestamp, endTimestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := map[string]interface{}{
+		"DocType": queryDocType,
+		"Timestamp": map[string]interface{}{
+			"$gte": startTimestamp,
+			"$lte": endTimestamp,
+		},
+	}
+	richQueries, err := richQueriesEnabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if richQueries {
+		return s.getQuerysBySelectorWithPagination(ctx, selector, timestampIndexDoc, pageSize, bookmark)
+	}
+
+	// The state database does not support rich queries. The bookmark of a composite-key
+	// page is the key to resume from, so the first page starts at the start timestamp.
+	if bookmark == "" {
+		bookmark, err = ctx.GetStub().CreateCompositeKey(timestampIndex, []string{formatTimestamp(startTimestamp)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", timestampIndex, err)
+		}
+	}
+
+	iterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(timestampIndex, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKeyWithPagination %s: %v", timestampIndex, err)
+	}
+	defer iterator.Close()
+
+	end := formatTimestamp(endTimestamp)
+	querys := []*Query{}
+	nextBookmark := responseMetadata.Bookmark
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to SplitCompositeKey %s: %v", response.Key, err)
+		}
+		if compositeKeyParts[0] > end {
+			nextBookmark = ""
+			break
+		}
+
+		query, err := s.ReadQuery(ctx, compositeKeyParts[len(compositeKeyParts)-1])
+		if err != nil {
+			return nil, err
+		}
+		querys = append(querys, query)
+	}
+
+	return newPaginatedQueryResult(querys, responseMetadata.FetchedRecordsCount, nextBookmark), nil
+}
+
+// getQuerysByIndexWithPagination is the paginated form of getQuerysByIndex.
+// Bookmarks are only meaningful to the kind of state database that issued them.
+func (s *QuerySmartContract) getQuerysByIndexWithPagination(ctx contractapi.TransactionContextInterface, selector map[string]interface{}, indexDoc string, objectType string, attributes []string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	richQueries, err := richQueriesEnabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if richQueries {
+		return s.getQuerysBySelectorWithPagination(ctx, selector, indexDoc, pageSize, bookmark)
+	}
+
+	iterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(objectType, attributes, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKeyWithPagination %s: %v", objectType, err)
+	}
+	defer iterator.Close()
+
+	querys, err := s.readQuerysFromIndexIterator(ctx, iterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPaginatedQueryResult(querys, responseMetadata.FetchedRecordsCount, responseMetadata.Bookmark), nil
+}
+
+// getQuerysBySelectorWithPagination runs a paginated CouchDB rich query. It returns an error on LevelDB.
+func (s *QuerySmartContract) getQuerysBySelectorWithPagination(ctx contractapi.TransactionContextInterface, selector map[string]interface{}, indexDoc string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	queryString, err := json.Marshal(map[string]interface{}{
+		"selector":  selector,
+		"use_index": []string{"_design/" + indexDoc},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal selector: %v", err)
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryString), pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run rich query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	querys, err := constructQuerysFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPaginatedQueryResult(querys, responseMetadata.FetchedRecordsCount, responseMetadata.Bookmark), nil
+}
+
+func newPaginatedQueryResult(querys []*Query, fetchedRecordsCount int32, bookmark string) *PaginatedQueryResult {
+	if querys == nil {
+		querys = []*Query{}
+	}
+
+	return &PaginatedQueryResult{
+		Bookmark:            bookmark,
+		FetchedRecordsCount: fetchedRecordsCount,
+		Records:             querys,
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readPages pages through a paginated lookup and returns the ids of every query it returned
+func (n *testNetwork) readPages(t *testing.T, client *testClient, function string, pageSize int, args ...string) []string {
+	ids := []string{}
+	bookmark := ""
+	for {
+		page := new(PaginatedQueryResult)
+		pageArgs := append(append([]string{}, args...), fmt.Sprint(pageSize), bookmark)
+		require.NoError(t, json.Unmarshal(n.mustInvoke(t, client, function, pageArgs...), page))
+		require.LessOrEqual(t, len(page.Records), pageSize)
+
+		for _, query := range page.Records {
+			ids = append(ids, query.QueryID)
+		}
+		if page.Bookmark == "" || len(page.Records) == 0 {
+			return ids
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+func TestPaginatedLookups(t *testing.T) {
+	for _, couchDB := range []bool{false, true} {
+		t.Run(fmt.Sprintf("couchDB=%v", couchDB), func(t *testing.T) {
+			network := newTestNetworkOn(t, couchDB)
+			user1 := network.ca.enroll(t, "user1", "client", nil)
+			user2 := network.ca.enroll(t, "user2", "client", nil)
+			for i := 1; i <= 5; i++ {
+				user := user1
+				if i%2 == 0 {
+					user = user2
+				}
+				require.NoError(t, network.createQuery(t, user, fmt.Sprintf("query%d", i), i))
+			}
+			all := []string{"query1", "query2", "query3", "query4", "query5"}
+
+			require.ElementsMatch(t, all, network.readPages(t, user1, "GetAllQuerysWithPagination", 2))
+			require.ElementsMatch(t, all, network.readPages(t, user1, "GetQueriesByServiceWithPagination", 2, testServiceID))
+			require.ElementsMatch(t, all, network.readPages(t, user1, "GetQueriesByTableWithPagination", 2, testTable))
+			require.ElementsMatch(t, []string{"query1", "query3", "query5"},
+				network.readPages(t, user1, "GetQueriesByInitiatorWithPagination", 2, testMSPID, user1.id(t)))
+
+			now := time.Now().Unix()
+			require.ElementsMatch(t, all,
+				network.readPages(t, user1, "GetQueriesInTimeRangeWithPagination", 2, fmt.Sprint(now-60), fmt.Sprint(now+60)))
+			require.Empty(t, network.readPages(t, user1, "GetQueriesInTimeRangeWithPagination", 2, "0", fmt.Sprint(now-60)))
+		})
+	}
+}
+
+// FetchedRecordsCount counts the records read for a page, also when the LevelDB time range scan filters them out
+func TestTimeRangePageCountsFetchedRecords(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, network.createQuery(t, user, fmt.Sprintf("query%d", i), i))
+	}
+
+	page := new(PaginatedQueryResult)
+	end := fmt.Sprint(time.Now().Unix() - 60)
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, user, "GetQueriesInTimeRangeWithPagination", "0", end, "10", ""), page))
+	require.Empty(t, page.Records)
+	require.Equal(t, int32(3), page.FetchedRecordsCount)
+	require.Equal(t, "", page.Bookmark)
+}
+
+func TestTimeRangeRejectsNegativeTimestamps(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	_, err := network.invoke(t, user, "GetQueriesInTimeRange", "-10", "10")
+	require.EqualError(t, err, "timestamps must not be negative, got -10 and 10")
+	_, err = network.invoke(t, user, "GetQueriesInTimeRangeWithPagination", "-10", "-5", "10", "")
+	require.EqualError(t, err, "timestamps must not be negative, got -10 and -5")
+	_, err = network.invoke(t, user, "GetQueriesInTimeRange", "10", "5")
+	require.EqualError(t, err, "start timestamp 10 is after end timestamp 5")
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/huyiwen/data-sharing/authz"
+)
+
+// delegatePolicy is what a service client must carry to create queries on behalf of end users
+var delegatePolicy = authz.Require(roleAttribute + "=" + serviceClientRole)
+
+// auditorPolicy and arbitratorPolicy are what reviewers of queries and resolvers of disputes must carry
+var auditorPolicy = authz.Require(auditorAttribute + "=true")
+var arbitratorPolicy = authz.Require(arbitratorAttribute + "=true")
+
+// issuerPolicy is what clients of the credit issuer MSP must carry to mint credits
+var issuerPolicy = authz.Require(roleAttribute + "=" + creditIssuerRole)
+
+// queryPolicies declares the certificate attributes the clients of each function of QuerySmartContract
+// must carry. They are checked before the function runs.
+var queryPolicies = authz.Policies{
+	"CreateQueryOnBehalfOf": delegatePolicy,
+	"EscalateQuery":         auditorPolicy,
+	"ListEscalatedReviews":  auditorPolicy,
+	"ListPendingReviews":    auditorPolicy,
+	"ResolveDispute":        arbitratorPolicy,
+	"ReviewQuery":           auditorPolicy,
+}
+
+// creditPolicies declares the certificate attributes the clients of each function of CreditTokenContract
+// must carry. They are checked before the function runs.
+var creditPolicies = authz.Policies{
+	"Mint": issuerPolicy,
+}
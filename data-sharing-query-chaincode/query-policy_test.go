@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReviewQueryRequiresAuditorAttribute(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+
+	// Neither a client without the attribute, nor the admin, nor one with another value may review
+	notAuditor := network.ca.enroll(t, "auditor1", "client", map[string]string{auditorAttribute: "false"})
+	for _, client := range []*testClient{user, network.admin, notAuditor} {
+		_, err := network.invoke(t, client, "ReviewQuery", "query1", legitimacyApproved, "looks fine")
+		require.EqualError(t, err, "permission denied for ReviewQuery: the client does not carry the attribute auditor=true")
+	}
+	require.Equal(t, legitimacyPending, network.readQuery(t, "query1").Legitimacy)
+
+	auditor := network.ca.enroll(t, "auditor2", "client", map[string]string{auditorAttribute: "true"})
+	network.mustInvoke(t, auditor, "ReviewQuery", "query1", legitimacyApproved, "looks fine")
+	require.Equal(t, legitimacyApproved, network.readQuery(t, "query1").Legitimacy)
+}
+
+func TestResolveDisputeRequiresArbitratorAttribute(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+	dispute, err := raiseDispute(t, network, user, "query1")
+	require.NoError(t, err)
+
+	_, err = network.invoke(t, user, "ResolveDispute", dispute.DisputeID, disputeUpheld, "the rows were altered")
+	require.EqualError(t, err, "permission denied for ResolveDispute: the client does not carry the attribute arbitrator=true")
+}
+
+func TestMintCreditsRequiresIssuerRole(t *testing.T) {
+	network := newTestNetwork(t)
+	network.mustInvoke(t, network.admin, "credit:Initialize", "Credit", "CRD", "2", testMSPID)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	_, err := network.invoke(t, user, "credit:Mint", "100")
+	require.EqualError(t, err, "permission denied for Mint: the client does not carry the attribute role=issuer")
+
+	issuer := network.ca.enroll(t, "issuer", "client", map[string]string{roleAttribute: creditIssuerRole})
+	network.mustInvoke(t, issuer, "credit:Mint", "100")
+	require.Equal(t, 100, network.creditBalance(t, issuer))
+}
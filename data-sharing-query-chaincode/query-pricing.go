@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// chargeQuery moves the price of a query, as set in the service registry of the service chaincode,
+// from the initiator's credit account to the service owner's and records the price in query.Charge.
+// It emits no Transfer event: a transaction keeps only its last event, so the charge is reported
+// through the Query event instead. Queries against services without a price, and queries of the
+// service owner itself, are free.
+func chargeQuery(ctx contractapi.TransactionContextInterface, query *Query) error {
+	service, err := readService(ctx, query.ServiceID)
+	if err != nil {
+		return err
+	}
+	if service.Price == 0 && service.PricePerRow == 0 {
+		return nil
+	}
+	if service.OwnerID == query.InitiatorID {
+		return nil
+	}
+
+	if query.DataRows > 0 && service.PricePerRow > math.MaxInt/query.DataRows {
+		return fmt.Errorf("math: multiplication overflow occurred %d * %d", service.PricePerRow, query.DataRows)
+	}
+	charge, err := addCredits(service.Price, service.PricePerRow*query.DataRows)
+	if err != nil {
+		return err
+	}
+
+	err = transferCredits(ctx, query.InitiatorID, service.OwnerID, charge)
+	if err != nil {
+		return fmt.Errorf("failed to charge %d credits for query %s: %v", charge, query.QueryID, err)
+	}
+
+	query.Charge = charge
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// newPricedTestNetwork returns a test network where the service registry prices queries against
+// testServiceID at 5 credits plus 10 per row, paid to owner
+func newPricedTestNetwork(t *testing.T) (*testNetwork, *testClient) {
+	network := newTestNetwork(t)
+	owner := network.ca.enroll(t, "provider", "client", nil)
+	network.mustInvoke(t, network.admin, "credit:Initialize", "Credit", "CRD", "2", testMSPID)
+
+	service := network.cards.services[testServiceID]
+	service.OwnerID = owner.id(t)
+	service.Price = 5
+	service.PricePerRow = 10
+	return network, owner
+}
+
+func (n *testNetwork) creditBalance(t *testing.T, client *testClient) int {
+	balance, err := strconv.Atoi(string(n.mustInvoke(t, client, "credit:BalanceOf", client.id(t))))
+	require.NoError(t, err)
+	return balance
+}
+
+// drainEvents returns the events emitted since it was last called, in the order they were set
+func (n *testNetwork) drainEvents() []*peer.ChaincodeEvent {
+	var events []*peer.ChaincodeEvent
+	for {
+		select {
+		case event := <-n.stub.ChaincodeEventsChannel:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// lastEvent returns the last event emitted since drainEvents was last called,
+// the only event of a transaction that Fabric delivers
+func (n *testNetwork) lastEvent(t *testing.T) *peer.ChaincodeEvent {
+	events := n.drainEvents()
+	require.NotEmpty(t, events)
+	return events[len(events)-1]
+}
+
+func TestCreateQueryChargesServicePrice(t *testing.T) {
+	network, owner := newPricedTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", map[string]string{roleAttribute: creditIssuerRole})
+	network.mustInvoke(t, user, "credit:Mint", "100")
+	network.drainEvents()
+
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+	require.Equal(t, 35, network.readQuery(t, "query1").Charge)
+	require.Equal(t, 65, network.creditBalance(t, user))
+	require.Equal(t, 35, network.creditBalance(t, owner))
+
+	// The charge reaches listeners through the Query event, the last event of the transaction
+	event := network.lastEvent(t)
+	require.Equal(t, "Query", event.EventName)
+	var query Query
+	require.NoError(t, json.Unmarshal(event.Payload, &query))
+	require.Equal(t, "query1", query.QueryID)
+	require.Equal(t, 35, query.Charge)
+
+	err := network.createQuery(t, user, "query2", 7)
+	require.ErrorContains(t, err, "insufficient funds")
+}
+
+func TestCreateQueryByServiceOwnerIsFree(t *testing.T) {
+	network, owner := newPricedTestNetwork(t)
+	network.drainEvents()
+
+	require.NoError(t, network.createQuery(t, owner, "query1", 3))
+	require.Equal(t, 0, network.readQuery(t, "query1").Charge)
+	require.Equal(t, 0, network.creditBalance(t, owner))
+
+	event := network.lastEvent(t)
+	require.Equal(t, "Query", event.EventName)
+	var query Query
+	require.NoError(t, json.Unmarshal(event.Payload, &query))
+	require.Equal(t, 0, query.Charge)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType name for differential-privacy budgets
+const privacyBudgetPrefix = "privacyBudget"
+
+// Budgets are kept in millionths of epsilon so that spending is exact and the same on every peer
+const epsilonScale = 1000000
+
+// PrivacyBudget is the total differential-privacy budget (epsilon) an initiator MSP may spend on a table
+type PrivacyBudget struct {
+	InitiatorMSPID string  `json:"InitiatorMSPID"`
+	Remaining      float64 `json:"Remaining"`
+	Spent          float64 `json:"Spent"`
+	TableHash      string  `json:"TableHash"`
+	Total          float64 `json:"Total"`
+}
+
+// privacyBudgetState is how a budget is stored, in millionths of epsilon
+type privacyBudgetState struct {
+	InitiatorMSPID string `json:"InitiatorMSPID"`
+	Spent          int64  `json:"Spent"`
+	TableHash      string `json:"TableHash"`
+	Total          int64  `json:"Total"`
+}
+
+// SetPrivacyBudget sets the total epsilon an initiator MSP may spend on a table. What was already spent
+// still counts against the new total. Only clients of the table owner's MSP may call it.
+func (s *QuerySmartContract) SetPrivacyBudget(ctx contractapi.TransactionContextInterface, tableHash string, initiatorMSPID string, totalEpsilon float64) (*PrivacyBudget, error) {
+	_, err := s.assertTableOwner(ctx, tableHash)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := scaleEpsilon(totalEpsilon)
+	if err != nil {
+		return nil, err
+	}
+
+	budget, err := readPrivacyBudget(ctx, tableHash, initiatorMSPID)
+	if err != nil {
+		return nil, err
+	}
+	if budget == nil {
+		budget = &privacyBudgetState{InitiatorMSPID: initiatorMSPID, TableHash: tableHash}
+	}
+
+	budget.Total = total
+	err = putPrivacyBudget(ctx, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	return budget.public(), nil
+}
+
+// GetPrivacyBudget returns the budget an initiator MSP has on a table and how much of it is spent
+func (s *QuerySmartContract) GetPrivacyBudget(ctx contractapi.TransactionContextInterface, tableHash string, initiatorMSPID string) (*PrivacyBudget, error) {
+	budget, err := readPrivacyBudget(ctx, tableHash, initiatorMSPID)
+	if err != nil {
+		return nil, err
+	}
+	if budget == nil {
+		return nil, fmt.Errorf("%s has no privacy budget on table %s", initiatorMSPID, tableHash)
+	}
+
+	return budget.public(), nil
+}
+
+// spendPrivacyBudget deducts the epsilon cost of a query from the budget of its initiator MSP on a table,
+// and fails if the budget would be exceeded. Queries without an epsilon cost need no budget.
+func spendPrivacyBudget(ctx contractapi.TransactionContextInterface, query *Query, tableHash string) error {
+	cost, err := scaleEpsilon(query.Epsilon)
+	if err != nil {
+		return err
+	}
+	if cost == 0 {
+		return nil
+	}
+
+	budget, err := readPrivacyBudget(ctx, tableHash, query.InitiatorMSPID)
+	if err != nil {
+		return err
+	}
+	if budget == nil {
+		return fmt.Errorf("%s has no privacy budget on table %s", query.InitiatorMSPID, tableHash)
+	}
+	// Compare against what is left rather than adding first, so that a huge cost cannot overflow Spent
+	if cost > budget.Total-budget.Spent {
+		return fmt.Errorf("an epsilon of %g would exceed the remaining privacy budget of %s on table %s", query.Epsilon, query.InitiatorMSPID, tableHash)
+	}
+
+	budget.Spent += cost
+	return putPrivacyBudget(ctx, budget)
+}
+
+// scaleEpsilon converts an epsilon to millionths, rounding up so that no positive epsilon is free.
+// A product within floating point error of a whole number of millionths is not rounded up.
+func scaleEpsilon(epsilon float64) (int64, error) {
+	if math.IsNaN(epsilon) || math.IsInf(epsilon, 0) || epsilon < 0 {
+		return 0, fmt.Errorf("epsilon must be a finite number that is not negative")
+	}
+	if epsilon > math.MaxInt64/epsilonScale {
+		return 0, fmt.Errorf("epsilon must not be greater than %d", int64(math.MaxInt64/epsilonScale))
+	}
+
+	scaled := epsilon * epsilonScale
+	if math.Abs(scaled-math.Round(scaled)) < 1e-6 {
+		return int64(math.Round(scaled)), nil
+	}
+	return int64(math.Ceil(scaled)), nil
+}
+
+func (b *privacyBudgetState) public() *PrivacyBudget {
+	remaining := b.Total - b.Spent
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &PrivacyBudget{
+		InitiatorMSPID: b.InitiatorMSPID,
+		Remaining:      float64(remaining) / epsilonScale,
+		Spent:          float64(b.Spent) / epsilonScale,
+		TableHash:      b.TableHash,
+		Total:          float64(b.Total) / epsilonScale,
+	}
+}
+
+func readPrivacyBudget(ctx contractapi.TransactionContextInterface, tableHash string, initiatorMSPID string) (*privacyBudgetState, error) {
+	budgetKey, err := ctx.GetStub().CreateCompositeKey(privacyBudgetPrefix, []string{tableHash, initiatorMSPID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", privacyBudgetPrefix, err)
+	}
+
+	budgetBytes, err := ctx.GetStub().GetState(budgetKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if budgetBytes == nil {
+		return nil, nil
+	}
+
+	var budget privacyBudgetState
+	err = json.Unmarshal(budgetBytes, &budget)
+	if err != nil {
+		return nil, err
+	}
+
+	return &budget, nil
+}
+
+func putPrivacyBudget(ctx contractapi.TransactionContextInterface, budget *privacyBudgetState) error {
+	budgetKey, err := ctx.GetStub().CreateCompositeKey(privacyBudgetPrefix, []string{budget.TableHash, budget.InitiatorMSPID})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", privacyBudgetPrefix, err)
+	}
+
+	budgetBytes, err := json.Marshal(budget)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(budgetKey, budgetBytes)
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", budgetKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaleEpsilon(t *testing.T) {
+	tests := []struct {
+		epsilon float64
+		want    int64
+		wantErr bool
+	}{
+		{epsilon: 0, want: 0},
+		{epsilon: 0.5, want: 500000},
+		{epsilon: 0.0000004, want: 1},
+		{epsilon: 0.0000011, want: 2},
+		{epsilon: 1.0000005, want: 1000001},
+		{epsilon: 0.3, want: 300000},
+		{epsilon: 1.1, want: 1100000},
+		{epsilon: 1e12, want: 1e18},
+		{epsilon: math.MaxInt64/epsilonScale + 0.5, wantErr: true},
+		{epsilon: 1e13, wantErr: true},
+		{epsilon: math.MaxFloat64, wantErr: true},
+		{epsilon: -0.1, wantErr: true},
+		{epsilon: math.NaN(), wantErr: true},
+		{epsilon: math.Inf(1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := scaleEpsilon(tt.epsilon)
+		if tt.wantErr {
+			require.Error(t, err, "scaleEpsilon(%g)", tt.epsilon)
+			continue
+		}
+		require.NoError(t, err, "scaleEpsilon(%g)", tt.epsilon)
+		require.Equal(t, tt.want, got, "scaleEpsilon(%g)", tt.epsilon)
+	}
+
+	// The largest epsilon is accepted, though not exactly representable in millionths
+	got, err := scaleEpsilon(math.MaxInt64 / epsilonScale)
+	require.NoError(t, err)
+	require.Greater(t, got, int64(0))
+}
+
+func TestSpendPrivacyBudget(t *testing.T) {
+	ctx, _ := newTestContext()
+	require.NoError(t, putPrivacyBudget(ctx, &privacyBudgetState{InitiatorMSPID: testMSPID, Spent: 0, TableHash: "table", Total: epsilonScale}))
+	spend := func(epsilon float64) error {
+		return spendPrivacyBudget(ctx, &Query{Epsilon: epsilon, InitiatorMSPID: testMSPID}, "table")
+	}
+
+	require.NoError(t, spend(0.75))
+	require.Error(t, spend(0.5))
+	require.Error(t, spend(1e13))
+	require.Error(t, spend(math.MaxInt64/epsilonScale))
+	require.NoError(t, spend(0.25))
+	require.Error(t, spend(0.000001))
+
+	budget, err := readPrivacyBudget(ctx, "table", testMSPID)
+	require.NoError(t, err)
+	require.Equal(t, int64(epsilonScale), budget.Spent)
+}
+
+// Epsilons below a millionth still spend the budget
+func TestSpendPrivacyBudgetChargesTinyEpsilon(t *testing.T) {
+	ctx, _ := newTestContext()
+	require.NoError(t, putPrivacyBudget(ctx, &privacyBudgetState{InitiatorMSPID: testMSPID, Spent: 0, TableHash: "table", Total: 2}))
+	spend := func(epsilon float64) error {
+		return spendPrivacyBudget(ctx, &Query{Epsilon: epsilon, InitiatorMSPID: testMSPID}, "table")
+	}
+
+	require.NoError(t, spend(0.0000004))
+	require.NoError(t, spend(0.0000004))
+	require.Error(t, spend(0.0000004))
+}
+
+func TestSpendPrivacyBudgetDoesNotOverflow(t *testing.T) {
+	ctx, _ := newTestContext()
+	require.NoError(t, putPrivacyBudget(ctx, &privacyBudgetState{InitiatorMSPID: testMSPID, Spent: math.MaxInt64 - epsilonScale, TableHash: "table", Total: math.MaxInt64}))
+
+	err := spendPrivacyBudget(ctx, &Query{Epsilon: 2, InitiatorMSPID: testMSPID}, "table")
+	require.Error(t, err)
+
+	budget, err := readPrivacyBudget(ctx, "table", testMSPID)
+	require.NoError(t, err)
+	require.Equal(t, int64(math.MaxInt64-epsilonScale), budget.Spent)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// transientQueryKey is the transient map key carrying the private details of a query
+const transientQueryKey = "query_properties"
+
+// minSaltLength is the shortest salt accepted for the public hashes of the private fields of a query
+const minSaltLength = 32
+
+// QueryPrivateDetails holds the sensitive fields of a query, kept in the initiator org's private data collection.
+// Signature is the base64 encoded signature of the initiator's certificate over QueryDigest.
+// Salt is a random string chosen by the client, which keys the public hashes of the other fields
+// so that they cannot be reversed by hashing guesses.
+type QueryPrivateDetails struct {
+	Certificate  string `json:"Certificate"`
+	QueriedTable string `json:"QueriedTable"`
+	QueryDigest  string `json:"QueryDigest"`
+	QueryID      string `json:"QueryID"`
+	Salt         string `json:"Salt"`
+	Signature    string `json:"Signature"`
+}
+
+// collectionName returns the name of the private data collection of an org.
+// The collections are declared in collections_config.json.
+func collectionName(mspID string) string {
+	return mspID + "PrivateCollection"
+}
+
+// hashField returns the hex encoded SHA-256 hash of a value
+func hashField(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+// hashPrivateField returns the hex encoded HMAC-SHA256 of a private field keyed with the salt of its query,
+// under which the field is published
+func hashPrivateField(salt string, value string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getQueryTransientInput reads the private details of a query from the transient map
+func getQueryTransientInput(ctx contractapi.TransactionContextInterface) (*QueryPrivateDetails, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+
+	transientQueryJSON, ok := transientMap[transientQueryKey]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in the transient map input", transientQueryKey)
+	}
+
+	var details QueryPrivateDetails
+	err = json.Unmarshal(transientQueryJSON, &details)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	err = validateQueryPrivateDetails(&details)
+	if err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// validateQueryPrivateDetails checks that every private field of a query is set
+func validateQueryPrivateDetails(details *QueryPrivateDetails) error {
+	if details.Certificate == "" {
+		return fmt.Errorf("Certificate field must be a non-empty string")
+	}
+	if details.QueriedTable == "" {
+		return fmt.Errorf("QueriedTable field must be a non-empty string")
+	}
+	if details.QueryDigest == "" {
+		return fmt.Errorf("QueryDigest field must be a non-empty string")
+	}
+	if len(details.Salt) < minSaltLength {
+		return fmt.Errorf("Salt field must be a random string of at least %d characters", minSaltLength)
+	}
+	if details.Signature == "" {
+		return fmt.Errorf("Signature field must be a non-empty string")
+	}
+
+	return nil
+}
+
+// putQueryPrivateDetails stores the private details of a query, and its table index entry,
+// in the collection of the given org
+func putQueryPrivateDetails(ctx contractapi.TransactionContextInterface, mspID string, details *QueryPrivateDetails) error {
+	detailsBytes, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutPrivateData(collectionName(mspID), details.QueryID, detailsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put query private details into collection %s: %v", collectionName(mspID), err)
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(tableIndex, []string{details.QueriedTable, details.QueryID})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", tableIndex, err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(collectionName(mspID), indexKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to put index %s into collection %s: %v", indexKey, collectionName(mspID), err)
+	}
+
+	return nil
+}
+
+// clientCollection returns the private data collection of the client's org,
+// checking that the client reads it through a peer of that org
+func clientCollection(ctx contractapi.TransactionContextInterface) (string, error) {
+	err := verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+
+	return collectionName(clientMSPID), nil
+}
+
+// ReadQueryPrivateDetails returns the private details of a query.
+// Only clients of the initiator's org may call it, on a peer of that org.
+func (s *QuerySmartContract) ReadQueryPrivateDetails(ctx contractapi.TransactionContextInterface, queryID string) (*QueryPrivateDetails, error) {
+	query, err := s.ReadQuery(ctx, queryID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+	if clientMSPID != query.InitiatorMSPID {
+		return nil, fmt.Errorf("client from org %s is not authorized to read the private details of query %s", clientMSPID, queryID)
+	}
+
+	detailsBytes, err := ctx.GetStub().GetPrivateData(collectionName(query.InitiatorMSPID), queryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from collection %s: %v", collectionName(query.InitiatorMSPID), err)
+	}
+	if detailsBytes == nil {
+		return nil, fmt.Errorf("the private details of query %s do not exist", queryID)
+	}
+
+	var details QueryPrivateDetails
+	err = json.Unmarshal(detailsBytes, &details)
+	if err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// verifyClientOrgMatchesPeerOrg is an internal function used to verify that the client
+// belongs to the same org as the peer, so that private data only leaves through its own org's peers
+func verifyClientOrgMatchesPeerOrg(ctx contractapi.TransactionContextInterface) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+
+	peerMSPID, err := shim.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the peer's MSPID: %v", err)
+	}
+
+	if clientMSPID != peerMSPID {
+		return fmt.Errorf("client from org %s is not authorized to read or write private data from an org %s peer", clientMSPID, peerMSPID)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readPrivateDetails reads the private details of a query as a client of the initiator's org
+func (n *testNetwork) readPrivateDetails(t *testing.T, client *testClient, queryID string) *QueryPrivateDetails {
+	details := new(QueryPrivateDetails)
+	require.NoError(t, json.Unmarshal(n.mustInvoke(t, client, "ReadQueryPrivateDetails", queryID), details))
+	return details
+}
+
+func TestPrivateFieldsArePublishedSalted(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+	require.NoError(t, network.createQuery(t, user, "query2", 3))
+
+	query1 := network.readQuery(t, "query1")
+	details1 := network.readPrivateDetails(t, user, "query1")
+	require.Equal(t, testTable, details1.QueriedTable)
+	require.Equal(t, hashPrivateField(details1.Salt, details1.QueriedTable), query1.QueriedTableHash)
+	require.Equal(t, hashPrivateField(details1.Salt, details1.QueryDigest), query1.QueryDigestHash)
+	require.Equal(t, hashPrivateField(details1.Salt, details1.Certificate), query1.CertificateHash)
+
+	// Guessing the table name does not reveal which queries read it
+	require.NotEqual(t, hashField(testTable), query1.QueriedTableHash)
+	require.NotEqual(t, query1.QueriedTableHash, network.readQuery(t, "query2").QueriedTableHash)
+}
+
+func TestCreateQueryRequiresSalt(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	details := user.details(t, "query1", "SELECT * FROM "+testTable)
+	details.Salt = "salt"
+	detailsBytes, err := json.Marshal(details)
+	require.NoError(t, err)
+
+	_, err = network.invokeWithTransient(t, user, map[string][]byte{transientQueryKey: detailsBytes},
+		"CreateQuery", testDataDigest, "3", "0", "query1", testServiceID)
+	require.EqualError(t, err, fmt.Sprintf("Salt field must be a random string of at least %d characters", minSaltLength))
+}
+
+func TestGetQueriesByTableMatchesThroughPrivateData(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+	require.NoError(t, network.createQuery(t, user, "query2", 3))
+
+	require.Equal(t, []string{"query1", "query2"}, queryIDs(t, network.mustInvoke(t, user, "GetQueriesByTable", testTable)))
+	require.Empty(t, queryIDs(t, network.mustInvoke(t, user, "GetQueriesByTable", hashField(testTable))))
+
+	// The table index lives in the collection of Org1MSP, which clients of other orgs cannot read
+	outsider := network.ca.enroll(t, "user2", "client", nil)
+	outsider.mspID = "Org2MSP"
+	_, err := network.invoke(t, outsider, "GetQueriesByTable", testTable)
+	require.EqualError(t, err, "client from org Org2MSP is not authorized to read or write private data from an org Org1MSP peer")
+	_, err = network.invoke(t, outsider, "ReadQueryPrivateDetails", "query1")
+	require.Error(t, err)
+}
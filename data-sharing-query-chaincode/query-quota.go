@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for quotas and the usage counted against them
+const quotaPrefix = "quota"
+const usagePrefix = "usage"
+
+// Define usage counter names. Days and months are calendar periods in UTC.
+const dailyQueries = "queriesPerDay"
+const monthlyRows = "rowsPerMonth"
+
+// Quota caps how much an initiator MSP may consume from a service.
+// A limit of 0 means unlimited.
+type Quota struct {
+	InitiatorMSPID string `json:"InitiatorMSPID"`
+	QueriesPerDay  int    `json:"QueriesPerDay"`
+	RowsPerMonth   int    `json:"RowsPerMonth"`
+	ServiceID      string `json:"ServiceID"`
+}
+
+// RemainingQuota is what an initiator MSP may still consume from a service in the current periods.
+// Remaining values are -1 when the corresponding limit is unlimited.
+type RemainingQuota struct {
+	InitiatorMSPID   string `json:"InitiatorMSPID"`
+	QueriesPerDay    int    `json:"QueriesPerDay"`
+	QueriesToday     int    `json:"QueriesToday"`
+	RemainingQueries int    `json:"RemainingQueries"`
+	RemainingRows    int    `json:"RemainingRows"`
+	RowsPerMonth     int    `json:"RowsPerMonth"`
+	RowsThisMonth    int    `json:"RowsThisMonth"`
+	ServiceID        string `json:"ServiceID"`
+}
+
+// SetQuota sets the quota of an initiator MSP for a service. Only the contract owner may call it.
+func (s *QuerySmartContract) SetQuota(ctx contractapi.TransactionContextInterface, initiatorMSPID string, serviceID string, queriesPerDay int, rowsPerMonth int) (*Quota, error) {
+	err := assertOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if queriesPerDay < 0 || rowsPerMonth < 0 {
+		return nil, fmt.Errorf("quota limits must not be negative")
+	}
+
+	quota := &Quota{
+		InitiatorMSPID: initiatorMSPID,
+		QueriesPerDay:  queriesPerDay,
+		RowsPerMonth:   rowsPerMonth,
+		ServiceID:      serviceID,
+	}
+	quotaBytes, err := json.Marshal(quota)
+	if err != nil {
+		return nil, err
+	}
+
+	quotaKey, err := ctx.GetStub().CreateCompositeKey(quotaPrefix, []string{initiatorMSPID, serviceID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", quotaPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(quotaKey, quotaBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to PutState %s: %v", quotaKey, err)
+	}
+
+	return quota, nil
+}
+
+// ReadQuota returns the quota of an initiator MSP for a service, or nil if it is unlimited
+func (s *QuerySmartContract) ReadQuota(ctx contractapi.TransactionContextInterface, initiatorMSPID string, serviceID string) (*Quota, error) {
+	return readQuota(ctx, initiatorMSPID, serviceID)
+}
+
+// GetRemainingQuota returns what an initiator MSP may still consume from a service today and this month
+func (s *QuerySmartContract) GetRemainingQuota(ctx contractapi.TransactionContextInterface, initiatorMSPID string, serviceID string) (*RemainingQuota, error) {
+	quota, err := readQuota(ctx, initiatorMSPID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if quota == nil {
+		quota = &Quota{InitiatorMSPID: initiatorMSPID, ServiceID: serviceID}
+	}
+
+	day, month, err := usagePeriods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queriesToday, err := readUsage(ctx, initiatorMSPID, serviceID, dailyQueries, day)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsThisMonth, err := readUsage(ctx, initiatorMSPID, serviceID, monthlyRows, month)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RemainingQuota{
+		InitiatorMSPID:   initiatorMSPID,
+		QueriesPerDay:    quota.QueriesPerDay,
+		QueriesToday:     queriesToday,
+		RemainingQueries: remaining(quota.QueriesPerDay, queriesToday),
+		RemainingRows:    remaining(quota.RowsPerMonth, rowsThisMonth),
+		RowsPerMonth:     quota.RowsPerMonth,
+		RowsThisMonth:    rowsThisMonth,
+		ServiceID:        serviceID,
+	}, nil
+}
+
+// consumeQuota counts a new query against the quota of its initiator MSP for its service,
+// and fails if the query would exceed it. Nothing is counted for services without a quota.
+func consumeQuota(ctx contractapi.TransactionContextInterface, query *Query) error {
+	quota, err := readQuota(ctx, query.InitiatorMSPID, query.ServiceID)
+	if err != nil {
+		return err
+	}
+	if quota == nil {
+		return nil
+	}
+
+	day, month, err := usagePeriods(ctx)
+	if err != nil {
+		return err
+	}
+
+	queriesToday, err := readUsage(ctx, query.InitiatorMSPID, query.ServiceID, dailyQueries, day)
+	if err != nil {
+		return err
+	}
+	if quota.QueriesPerDay > 0 && queriesToday+1 > quota.QueriesPerDay {
+		return fmt.Errorf("%s has used its quota of %d queries per day on service %s", query.InitiatorMSPID, quota.QueriesPerDay, query.ServiceID)
+	}
+
+	rowsThisMonth, err := readUsage(ctx, query.InitiatorMSPID, query.ServiceID, monthlyRows, month)
+	if err != nil {
+		return err
+	}
+	// Compare against what is left rather than adding first, DataRows comes from the client and may be huge
+	if quota.RowsPerMonth > 0 && query.DataRows > quota.RowsPerMonth-rowsThisMonth {
+		return fmt.Errorf("%d more rows would exceed the quota of %d rows per month of %s on service %s", query.DataRows, quota.RowsPerMonth, query.InitiatorMSPID, query.ServiceID)
+	}
+	if query.DataRows > math.MaxInt-rowsThisMonth {
+		return fmt.Errorf("%d more rows would overflow the rows this month of %s on service %s", query.DataRows, query.InitiatorMSPID, query.ServiceID)
+	}
+
+	err = putUsage(ctx, query.InitiatorMSPID, query.ServiceID, dailyQueries, day, queriesToday+1)
+	if err != nil {
+		return err
+	}
+
+	return putUsage(ctx, query.InitiatorMSPID, query.ServiceID, monthlyRows, month, rowsThisMonth+query.DataRows)
+}
+
+func readQuota(ctx contractapi.TransactionContextInterface, initiatorMSPID string, serviceID string) (*Quota, error) {
+	quotaKey, err := ctx.GetStub().CreateCompositeKey(quotaPrefix, []string{initiatorMSPID, serviceID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", quotaPrefix, err)
+	}
+
+	quotaBytes, err := ctx.GetStub().GetState(quotaKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if quotaBytes == nil {
+		return nil, nil
+	}
+
+	var quota Quota
+	err = json.Unmarshal(quotaBytes, &quota)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quota, nil
+}
+
+// usagePeriods returns the current day and month of the transaction
+func usagePeriods(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	timestamp, err := getTxTimestamp(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	txTime := time.Unix(int64(timestamp), 0).UTC()
+	return txTime.Format("2006-01-02"), txTime.Format("2006-01"), nil
+}
+
+func readUsage(ctx contractapi.TransactionContextInterface, initiatorMSPID string, serviceID string, counter string, period string) (int, error) {
+	usageKey, err := ctx.GetStub().CreateCompositeKey(usagePrefix, []string{initiatorMSPID, serviceID, counter, period})
+	if err != nil {
+		return 0, fmt.Errorf("failed to CreateCompositeKey %s: %v", usagePrefix, err)
+	}
+
+	usageBytes, err := ctx.GetStub().GetState(usageKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if usageBytes == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(usageBytes))
+}
+
+func putUsage(ctx contractapi.TransactionContextInterface, initiatorMSPID string, serviceID string, counter string, period string, usage int) error {
+	usageKey, err := ctx.GetStub().CreateCompositeKey(usagePrefix, []string{initiatorMSPID, serviceID, counter, period})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", usagePrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(usageKey, []byte(strconv.Itoa(usage)))
+	if err != nil {
+		return fmt.Errorf("failed to PutState %s: %v", usageKey, err)
+	}
+
+	return nil
+}
+
+func remaining(limit int, used int) int {
+	if limit == 0 {
+		return -1
+	}
+	if used > limit {
+		return 0
+	}
+	return limit - used
+}
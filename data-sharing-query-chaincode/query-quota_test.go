@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// remainingQuota reads the remaining quota of testMSPID on a service
+func (n *testNetwork) remainingQuota(t *testing.T, client *testClient, serviceID string) *RemainingQuota {
+	remaining := new(RemainingQuota)
+	require.NoError(t, json.Unmarshal(n.mustInvoke(t, client, "GetRemainingQuota", testMSPID, serviceID), remaining))
+	return remaining
+}
+
+func TestQuotaLimitsQueriesAndRows(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+
+	_, err := network.invoke(t, network.admin, "SetQuota", testMSPID, testServiceID, "-1", "0")
+	require.EqualError(t, err, "quota limits must not be negative")
+	network.mustInvoke(t, network.admin, "SetQuota", testMSPID, testServiceID, "2", "5")
+
+	require.NoError(t, network.createQuery(t, user, "query1", 2))
+	err = network.createQuery(t, user, "query2", 4)
+	require.EqualError(t, err, fmt.Sprintf("4 more rows would exceed the quota of 5 rows per month of %s on service %s", testMSPID, testServiceID))
+	err = network.createQuery(t, user, "query2", math.MaxInt)
+	require.Error(t, err)
+	require.NoError(t, network.createQuery(t, user, "query2", 3))
+	err = network.createQuery(t, user, "query3", 0)
+	require.EqualError(t, err, fmt.Sprintf("%s has used its quota of 2 queries per day on service %s", testMSPID, testServiceID))
+
+	remaining := network.remainingQuota(t, user, testServiceID)
+	require.Equal(t, 2, remaining.QueriesToday)
+	require.Equal(t, 0, remaining.RemainingQueries)
+	require.Equal(t, 5, remaining.RowsThisMonth)
+	require.Equal(t, 0, remaining.RemainingRows)
+}
+
+func TestRemainingQuotaWithoutQuota(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	require.NoError(t, network.createQuery(t, user, "query1", 2))
+
+	// Nothing is counted for services without a quota
+	remaining := network.remainingQuota(t, user, testServiceID)
+	require.Equal(t, 0, remaining.QueriesToday)
+	require.Equal(t, -1, remaining.RemainingQueries)
+	require.Equal(t, -1, remaining.RemainingRows)
+}
+
+func TestUsagePeriodsAreUTCCalendarPeriods(t *testing.T) {
+	ctx, stub := newTestContext()
+	endOfJanuary := time.Date(2024, time.January, 31, 23, 59, 59, 0, time.UTC)
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: endOfJanuary.Unix()}
+
+	day, month, err := usagePeriods(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "2024-01-31", day)
+	require.Equal(t, "2024-01", month)
+
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: endOfJanuary.Unix() + 1}
+	day, month, err = usagePeriods(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "2024-02-01", day)
+	require.Equal(t, "2024-02", month)
+}
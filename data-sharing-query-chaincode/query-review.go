@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Legitimacy states of a query. A query starts pending and ends approved or rejected;
+// an escalated query waits for a second review.
+const legitimacyPending = "pending"
+const legitimacyApproved = "approved"
+const legitimacyRejected = "rejected"
+const legitimacyEscalated = "escalated"
+
+// Define objectType name for the review trail of a query
+const reviewPrefix = "review"
+
+// Identities allowed to review queries carry this certificate attribute
+const auditorAttribute = "auditor"
+
+// LegitimacyReview records one legitimacy transition of a query
+type LegitimacyReview struct {
+	FromStatus    string `json:"FromStatus"`
+	QueryID       string `json:"QueryID"`
+	Reason        string `json:"Reason"`
+	ReviewerID    string `json:"ReviewerID"`
+	ReviewerMSPID string `json:"ReviewerMSPID"`
+	Timestamp     int    `json:"Timestamp"`
+	ToStatus      string `json:"ToStatus"`
+	TxID          string `json:"TxID"`
+}
+
+// legitimacyTransitions lists the states each state may move to
+var legitimacyTransitions = map[string][]string{
+	legitimacyPending:   {legitimacyApproved, legitimacyRejected, legitimacyEscalated},
+	legitimacyEscalated: {legitimacyApproved, legitimacyRejected},
+}
+
+// ReviewQuery approves or rejects a pending or escalated query. Only auditors may call it,
+// and not on queries they initiated or submitted.
+func (s *QuerySmartContract) ReviewQuery(ctx contractapi.TransactionContextInterface, queryID string, decision string, reason string) (*LegitimacyReview, error) {
+	if decision != legitimacyApproved && decision != legitimacyRejected {
+		return nil, fmt.Errorf("decision must be %s or %s, got %q", legitimacyApproved, legitimacyRejected, decision)
+	}
+
+	return s.transitionLegitimacy(ctx, queryID, decision, reason)
+}
+
+// EscalateQuery hands a pending query over to a second review. Only auditors may call it,
+// and not on queries they initiated or submitted.
+func (s *QuerySmartContract) EscalateQuery(ctx contractapi.TransactionContextInterface, queryID string, reason string) (*LegitimacyReview, error) {
+	return s.transitionLegitimacy(ctx, queryID, legitimacyEscalated, reason)
+}
+
+// ListPendingReviews returns one page of the queries waiting for their first review. Only auditors may call it.
+func (s *QuerySmartContract) ListPendingReviews(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	return s.getQuerysByLegitimacyWithPagination(ctx, legitimacyPending, pageSize, bookmark)
+}
+
+// ListEscalatedReviews returns one page of the escalated queries waiting for their second review. Only auditors may call it.
+func (s *QuerySmartContract) ListEscalatedReviews(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	return s.getQuerysByLegitimacyWithPagination(ctx, legitimacyEscalated, pageSize, bookmark)
+}
+
+func (s *QuerySmartContract) getQuerysByLegitimacyWithPagination(ctx contractapi.TransactionContextInterface, legitimacy string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	selector := map[string]interface{}{
+		"DocType":    queryDocType,
+		"Legitimacy": legitimacy,
+	}
+	return s.getQuerysByIndexWithPagination(ctx, selector, legitimacyIndexDoc, legitimacyIndex, []string{legitimacy}, pageSize, bookmark)
+}
+
+// GetQueryReviews returns the legitimacy transitions of a query, oldest first
+func (s *QuerySmartContract) GetQueryReviews(ctx contractapi.TransactionContextInterface, queryID string) ([]*LegitimacyReview, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(reviewPrefix, []string{queryID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKey %s: %v", reviewPrefix, err)
+	}
+	defer resultsIterator.Close()
+
+	var reviews []*LegitimacyReview
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var review LegitimacyReview
+		err = json.Unmarshal(response.Value, &review)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, &review)
+	}
+
+	return reviews, nil
+}
+
+// transitionLegitimacy moves a query to a new legitimacy state, records the review and emits the QueryReview event
+func (s *QuerySmartContract) transitionLegitimacy(ctx contractapi.TransactionContextInterface, queryID string, toStatus string, reason string) (*LegitimacyReview, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to review query %s", queryID)
+	}
+
+	query, legacy, err := readQuery(ctx, queryID)
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		return nil, fmt.Errorf("the query %s must be moved with MigrateQueryKeys before it can be reviewed", queryID)
+	}
+
+	allowed := false
+	for _, status := range legitimacyTransitions[query.Legitimacy] {
+		if status == toStatus {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("the query %s cannot move from %s to %s", queryID, query.Legitimacy, toStatus)
+	}
+
+	reviewerID, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewerMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSPID: %v", err)
+	}
+	initiator := reviewerID == query.InitiatorID && reviewerMSPID == query.InitiatorMSPID
+	submitter := reviewerID == query.SubmitterID && reviewerMSPID == query.SubmitterMSPID
+	if initiator || submitter {
+		return nil, fmt.Errorf("the initiator or submitter of query %s cannot review it", queryID)
+	}
+
+	timestamp, err := getTxTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	review := &LegitimacyReview{
+		FromStatus:    query.Legitimacy,
+		QueryID:       queryID,
+		Reason:        reason,
+		ReviewerID:    reviewerID,
+		ReviewerMSPID: reviewerMSPID,
+		Timestamp:     timestamp,
+		ToStatus:      toStatus,
+		TxID:          ctx.GetStub().GetTxID(),
+	}
+
+	// Move the query from the old to the new legitimacy index entry
+	oldIndexKey, err := ctx.GetStub().CreateCompositeKey(legitimacyIndex, []string{query.Legitimacy, queryID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", legitimacyIndex, err)
+	}
+	err = ctx.GetStub().DelState(oldIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to DelState %s: %v", oldIndexKey, err)
+	}
+
+	newIndexKey, err := ctx.GetStub().CreateCompositeKey(legitimacyIndex, []string{toStatus, queryID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", legitimacyIndex, err)
+	}
+	err = ctx.GetStub().PutState(newIndexKey, []byte{0x00})
+	if err != nil {
+		return nil, fmt.Errorf("failed to PutState %s: %v", newIndexKey, err)
+	}
+
+	query.Legitimacy = toStatus
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	key, err := queryKey(ctx, queryID)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(key, queryBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to PutState %s: %v", queryID, err)
+	}
+
+	reviewKey, err := ctx.GetStub().CreateCompositeKey(reviewPrefix, []string{queryID, formatTimestamp(timestamp), review.TxID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", reviewPrefix, err)
+	}
+	reviewBytes, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(reviewKey, reviewBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to PutState %s: %v", reviewKey, err)
+	}
+
+	err = ctx.GetStub().SetEvent("QueryReview", reviewBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to SetEvent QueryReview: %v", err)
+	}
+
+	return review, nil
+}
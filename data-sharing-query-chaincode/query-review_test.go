@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReviewWorkflow(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", "client", nil)
+	auditor := network.ca.enroll(t, "auditor", "client", map[string]string{auditorAttribute: "true"})
+	require.NoError(t, network.createQuery(t, user, "query1", 3))
+	require.NoError(t, network.createQuery(t, user, "query2", 3))
+
+	require.Equal(t, []string{"query1", "query2"}, network.readPages(t, auditor, "ListPendingReviews", 10))
+	require.Empty(t, network.readPages(t, auditor, "ListEscalatedReviews", 10))
+
+	_, err := network.invoke(t, auditor, "ReviewQuery", "query1", legitimacyEscalated, "needs a second look")
+	require.EqualError(t, err, `decision must be approved or rejected, got "escalated"`)
+	_, err = network.invoke(t, auditor, "EscalateQuery", "query1", "")
+	require.EqualError(t, err, "a reason is required to review query query1")
+
+	network.mustInvoke(t, auditor, "EscalateQuery", "query1", "needs a second look")
+	require.Equal(t, []string{"query2"}, network.readPages(t, auditor, "ListPendingReviews", 10))
+	require.Equal(t, []string{"query1"}, network.readPages(t, auditor, "ListEscalatedReviews", 10))
+
+	network.mustInvoke(t, auditor, "ReviewQuery", "query1", legitimacyApproved, "the purpose is covered")
+	require.Empty(t, network.readPages(t, auditor, "ListEscalatedReviews", 10))
+	require.Equal(t, legitimacyApproved, network.readQuery(t, "query1").Legitimacy)
+
+	_, err = network.invoke(t, auditor, "ReviewQuery", "query1", legitimacyRejected, "changed my mind")
+	require.EqualError(t, err, "the query query1 cannot move from approved to rejected")
+
+	var reviews []*LegitimacyReview
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, user, "GetQueryReviews", "query1"), &reviews))
+	require.Len(t, reviews, 2)
+	require.Equal(t, legitimacyPending, reviews[0].FromStatus)
+	require.Equal(t, legitimacyEscalated, reviews[0].ToStatus)
+	require.Equal(t, legitimacyApproved, reviews[1].ToStatus)
+	require.Equal(t, auditor.id(t), reviews[1].ReviewerID)
+}
+
+func TestReviewQueryRejectsInitiatorAndSubmitter(t *testing.T) {
+	network := newTestNetwork(t)
+	auditor := network.ca.enroll(t, "auditor", "client", map[string]string{auditorAttribute: "true"})
+	serviceAuditor := network.ca.enroll(t, "service", "client", map[string]string{roleAttribute: serviceClientRole, auditorAttribute: "true"})
+	user := network.ca.enroll(t, "user1", "client", nil)
+	require.NoError(t, network.createQuery(t, auditor, "query1", 3))
+	network.mustInvoke(t, user, "GrantDelegation", testMSPID, serviceAuditor.id(t), "0")
+	require.NoError(t, network.createQueryOnBehalfOf(t, serviceAuditor, user, "query2"))
+
+	_, err := network.invoke(t, auditor, "ReviewQuery", "query1", legitimacyApproved, "looks fine")
+	require.EqualError(t, err, "the initiator or submitter of query query1 cannot review it")
+	_, err = network.invoke(t, auditor, "EscalateQuery", "query1", "needs a second look")
+	require.EqualError(t, err, "the initiator or submitter of query query1 cannot review it")
+	_, err = network.invoke(t, serviceAuditor, "ReviewQuery", "query2", legitimacyApproved, "looks fine")
+	require.EqualError(t, err, "the initiator or submitter of query query2 cannot review it")
+
+	network.mustInvoke(t, serviceAuditor, "ReviewQuery", "query1", legitimacyApproved, "looks fine")
+	network.mustInvoke(t, auditor, "ReviewQuery", "query2", legitimacyRejected, "no consent for the purpose")
+}
@@ -0,0 +1,71 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// collectionsgen writes the private data collection config of the query chaincode,
+// one collection per org, as expected by `peer lifecycle chaincode --collections-config`.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type endorsementPolicy struct {
+	SignaturePolicy string `json:"signaturePolicy"`
+}
+
+type collectionConfig struct {
+	Name              string             `json:"name"`
+	Policy            string             `json:"policy"`
+	RequiredPeerCount int                `json:"requiredPeerCount"`
+	MaxPeerCount      int                `json:"maxPeerCount"`
+	BlockToLive       int                `json:"blockToLive"`
+	MemberOnlyRead    bool               `json:"memberOnlyRead"`
+	MemberOnlyWrite   bool               `json:"memberOnlyWrite"`
+	EndorsementPolicy *endorsementPolicy `json:"endorsementPolicy"`
+}
+
+func main() {
+	orgs := flag.String("orgs", "Org1MSP,Org2MSP", "comma separated MSP IDs of the orgs that log queries")
+	out := flag.String("out", "collections_config.json", "output file")
+	flag.Parse()
+
+	var collections []collectionConfig
+	for _, mspID := range strings.Split(*orgs, ",") {
+		mspID = strings.TrimSpace(mspID)
+		if mspID == "" {
+			continue
+		}
+
+		// Keep in sync with collectionName in query-private.go
+		memberPolicy := fmt.Sprintf("OR('%s.member')", mspID)
+		collections = append(collections, collectionConfig{
+			Name:              mspID + "PrivateCollection",
+			Policy:            memberPolicy,
+			RequiredPeerCount: 0,
+			MaxPeerCount:      1,
+			BlockToLive:       0,
+			MemberOnlyRead:    true,
+			MemberOnlyWrite:   false,
+			EndorsementPolicy: &endorsementPolicy{SignaturePolicy: memberPolicy},
+		})
+	}
+	if len(collections) == 0 {
+		log.Fatalf("no orgs given")
+	}
+
+	collectionsBytes, err := json.MarshalIndent(collections, "", "  ")
+	if err != nil {
+		log.Fatalf("failed to marshal collections config: %v", err)
+	}
+
+	err = os.WriteFile(*out, append(collectionsBytes, '\n'), 0644)
+	if err != nil {
+		log.Fatalf("failed to write %s: %v", *out, err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// MintBatch mints cards to several recipients in one transaction. The cards are for the services named
+// by their token URIs, never expire and are unmetered. If any card cannot be minted, none is.
+// param {Array} recipients The owners of the cards, in the format of ClientAccountID
+// param {Array} tokenIds Unique IDs of the cards, one per recipient
+// param {Array} tokenURIs URIs of the cards, one per recipient
+// returns {Array} Return the transfer from 0x0 of every card, in order
+func (c *TokenERC721Contract) MintBatch(ctx contractapi.TransactionContextInterface, recipients []string, tokenIds []string, tokenURIs []string) ([]*Transfer, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if len(tokenIds) == 0 {
+		return nil, fmt.Errorf("no tokens to mint")
+	}
+	if len(recipients) != len(tokenIds) || len(tokenURIs) != len(tokenIds) {
+		return nil, fmt.Errorf("got %d recipients, %d token IDs and %d token URIs, expected as many of each", len(recipients), len(tokenIds), len(tokenURIs))
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clientMSPID: %v", err)
+	}
+
+	// Get ID of submitting client identity
+	minter, err := GetClientIdentity(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetClientIdentity: %v", err)
+	}
+
+	// The world state does not show the writes of this transaction, so tokens minted twice are caught here
+	minted := map[string]bool{}
+	transfers := []*Transfer{}
+	for i, tokenId := range tokenIds {
+		if minted[tokenId] {
+			return nil, fmt.Errorf("failed to mint token %d (%s): the token is minted twice in the batch", i, tokenId)
+		}
+		minted[tokenId] = true
+
+		err = _validateIdentity(recipients[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to mint token %d (%s): %v", i, tokenId, err)
+		}
+
+		_, err = _mintNFT(ctx, clientMSPID, minter, recipients[i], tokenId, tokenURIs[i], "", 0, 0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mint token %d (%s): %v", i, tokenId, err)
+		}
+
+		transfer := new(Transfer)
+		transfer.From = "0x0"
+		transfer.To = recipients[i]
+		transfer.TokenId = tokenId
+		transfers = append(transfers, transfer)
+	}
+
+	err = _emitBatchTransfer(ctx, transfers)
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// TransferBatch transfers several non-fungible tokens from one owner to another in one transaction.
+// If any token cannot be transferred, none is.
+// param {String} from The current owner of the non-fungible tokens
+// param {String} to The new owner
+// param {Array} tokenIds The non-fungible tokens to transfer
+// returns {Array} Return the transfer of every token, in order
+func (c *TokenERC721Contract) TransferBatch(ctx contractapi.TransactionContextInterface, from string, to string, tokenIds []string) ([]*Transfer, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if len(tokenIds) == 0 {
+		return nil, fmt.Errorf("no tokens to transfer")
+	}
+
+	// Get ID of submitting client identity
+	sender, err := GetClientIdentity(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetClientIdentity: %v", err)
+	}
+
+	transferred := map[string]bool{}
+	transfers := []*Transfer{}
+	for i, tokenId := range tokenIds {
+		if transferred[tokenId] {
+			return nil, fmt.Errorf("failed to transfer token %d (%s): the token is transferred twice in the batch", i, tokenId)
+		}
+		transferred[tokenId] = true
+
+		err = c._transferNFT(ctx, sender, from, to, tokenId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transfer token %d (%s): %v", i, tokenId, err)
+		}
+
+		transfer := new(Transfer)
+		transfer.From = from
+		transfer.To = to
+		transfer.TokenId = tokenId
+		transfers = append(transfers, transfer)
+	}
+
+	err = _emitBatchTransfer(ctx, transfers)
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// _emitBatchTransfer emits the TransferBatch event. A transaction keeps only its last event,
+// so a batch reports all of its transfers in one event instead of a Transfer event per token.
+func _emitBatchTransfer(ctx contractapi.TransactionContextInterface, transfers []*Transfer) error {
+	batchEvent := new(BatchTransfer)
+	batchEvent.Transfers = transfers
+
+	batchEventBytes, err := json.Marshal(batchEvent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal batchEventBytes: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("TransferBatch", batchEventBytes)
+	if err != nil {
+		return fmt.Errorf("failed to SetEvent batchEventBytes %s: %v", batchEventBytes, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jsonArray encodes the strings as a JSON array argument
+func jsonArray(t *testing.T, values ...string) string {
+	valuesBytes, err := json.Marshal(values)
+	require.NoError(t, err)
+	return string(valuesBytes)
+}
+
+// lastBatchTransfer returns the transfers of the last TransferBatch event emitted
+func (n *testNetwork) lastBatchTransfer(t *testing.T) []*Transfer {
+	var batch *BatchTransfer
+	for len(n.stub.ChaincodeEventsChannel) > 0 {
+		event := <-n.stub.ChaincodeEventsChannel
+		batch = nil
+		if event.EventName == "TransferBatch" {
+			batch = new(BatchTransfer)
+			require.NoError(t, json.Unmarshal(event.Payload, batch))
+		}
+	}
+	require.NotNil(t, batch)
+	return batch.Transfers
+}
+
+func TestMintBatch(t *testing.T) {
+	network := newTestNetwork(t)
+	user1 := network.ca.enroll(t, "user1", nil)
+	user2 := network.ca.enroll(t, "user2", nil)
+	recipients := jsonArray(t, network.id(t, user1), network.id(t, user2))
+
+	payload := network.mustInvoke(t, network.minter, "MintBatch", recipients, jsonArray(t, "card1", "card2"), jsonArray(t, testServiceID, testServiceID))
+	var transfers []*Transfer
+	require.NoError(t, json.Unmarshal(payload, &transfers))
+	expected := []*Transfer{
+		{From: "0x0", To: network.id(t, user1), TokenId: "card1"},
+		{From: "0x0", To: network.id(t, user2), TokenId: "card2"},
+	}
+	require.Equal(t, expected, transfers)
+	require.Equal(t, expected, network.lastBatchTransfer(t))
+
+	require.Equal(t, network.id(t, user1), string(network.mustInvoke(t, user1, "OwnerOf", "card1")))
+	require.Equal(t, network.id(t, user2), string(network.mustInvoke(t, user2, "OwnerOf", "card2")))
+}
+
+func TestMintBatchIsAtomic(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	recipient := network.id(t, user)
+
+	_, err := network.invoke(t, network.minter, "MintBatch", jsonArray(t, recipient), jsonArray(t, "card1", "card2"), jsonArray(t, testServiceID))
+	require.EqualError(t, err, "got 1 recipients, 2 token IDs and 1 token URIs, expected as many of each")
+	_, err = network.invoke(t, network.minter, "MintBatch", "[]", "[]", "[]")
+	require.EqualError(t, err, "no tokens to mint")
+
+	// A bad token anywhere in the batch mints none of them
+	_, err = network.invoke(t, network.minter, "MintBatch", jsonArray(t, recipient, recipient), jsonArray(t, "card1", "card1"), jsonArray(t, testServiceID, testServiceID))
+	require.EqualError(t, err, "failed to mint token 1 (card1): the token is minted twice in the batch")
+	_, err = network.invoke(t, network.minter, "MintBatch", jsonArray(t, recipient, "user2"), jsonArray(t, "card1", "card2"), jsonArray(t, testServiceID, testServiceID))
+	require.ErrorContains(t, err, "failed to mint token 1 (card2)")
+	_, err = network.invoke(t, network.minter, "MintBatch", jsonArray(t, recipient, recipient), jsonArray(t, "card1", "card2"), jsonArray(t, testServiceID, "service2"))
+	require.ErrorContains(t, err, "failed to mint token 1 (card2)")
+
+	_, err = network.invoke(t, user, "OwnerOf", "card1")
+	require.Error(t, err)
+	require.Equal(t, "0", string(network.mustInvoke(t, user, "BalanceOf", recipient)))
+}
+
+func TestTransferBatch(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	other := network.ca.enroll(t, "user2", nil)
+	network.mintTo(t, user, "card1", 0, 0)
+	network.mintTo(t, user, "card2", 0, 0)
+	network.mintTo(t, other, "card3", 0, 0)
+	from, to := network.id(t, user), network.id(t, other)
+
+	_, err := network.invoke(t, user, "TransferBatch", from, to, "[]")
+	require.EqualError(t, err, "no tokens to transfer")
+	_, err = network.invoke(t, user, "TransferBatch", from, to, jsonArray(t, "card1", "card1"))
+	require.EqualError(t, err, "failed to transfer token 1 (card1): the token is transferred twice in the batch")
+
+	// A token the sender may not transfer fails the whole batch
+	_, err = network.invoke(t, user, "TransferBatch", from, to, jsonArray(t, "card1", "card3"))
+	require.ErrorContains(t, err, "failed to transfer token 1 (card3)")
+	require.Equal(t, from, string(network.mustInvoke(t, user, "OwnerOf", "card1")))
+
+	payload := network.mustInvoke(t, user, "TransferBatch", from, to, jsonArray(t, "card1", "card2"))
+	var transfers []*Transfer
+	require.NoError(t, json.Unmarshal(payload, &transfers))
+	expected := []*Transfer{
+		{From: from, To: to, TokenId: "card1"},
+		{From: from, To: to, TokenId: "card2"},
+	}
+	require.Equal(t, expected, transfers)
+	require.Equal(t, expected, network.lastBatchTransfer(t))
+	require.Equal(t, "3", string(network.mustInvoke(t, other, "BalanceOf", to)))
+}
@@ -319,24 +319,50 @@ func (c *TokenERC721Contract) TransferFrom(ctx contractapi.TransactionContextInt
 		return false, fmt.Errorf("failed to GetClientIdentity: %v", err)
 	}
 
+	err = c._transferNFT(ctx, sender, from, to, tokenId)
+	if err != nil {
+		return false, err
+	}
+
+	// Emit the Transfer event
+	transferEvent := new(Transfer)
+	transferEvent.From = from
+	transferEvent.To = to
+	transferEvent.TokenId = tokenId
+
+	transferEventBytes, err := json.Marshal(transferEvent)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal transferEventBytes: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("Transfer", transferEventBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to SetEvent transferEventBytes %s: %v", transferEventBytes, err)
+	}
+	return true, nil
+}
+
+// _transferNFT moves a non-fungible token from its current owner to a new owner on behalf of the sender,
+// who must be the owner or an authorized operator. It does not emit the Transfer event.
+func (c *TokenERC721Contract) _transferNFT(ctx contractapi.TransactionContextInterface, sender string, from string, to string, tokenId string) error {
 	nft, err := _readNFT(ctx, tokenId)
 	if err != nil {
-		return false, fmt.Errorf("failed to _readNFT : %v", err)
+		return fmt.Errorf("failed to _readNFT : %v", err)
 	}
 
 	owner := nft.Owner
 	operator := nft.Approved
 	operatorApproval, err := c.IsApprovedForAll(ctx, owner, sender)
 	if err != nil {
-		return false, fmt.Errorf("failed to get IsApprovedForAll : %v", err)
+		return fmt.Errorf("failed to get IsApprovedForAll : %v", err)
 	}
 	if owner != sender && operator != sender && !operatorApproval {
-		return false, fmt.Errorf("the sender is not the current owner nor an authorized operator")
+		return fmt.Errorf("the sender is not the current owner nor an authorized operator")
 	}
 
 	// Check if `from` is the current owner
 	if owner != from {
-		return false, fmt.Errorf("the from is not the current owner")
+		return fmt.Errorf("the from is not the current owner")
 	}
 
 	// Clear the approved client for this non-fungible token
@@ -346,56 +372,41 @@ func (c *TokenERC721Contract) TransferFrom(ctx contractapi.TransactionContextInt
 	nft.Owner = to
 	nftKey, err := ctx.GetStub().CreateCompositeKey(nftPrefix, []string{tokenId})
 	if err != nil {
-		return false, fmt.Errorf("failed to CreateCompositeKey: %v", err)
+		return fmt.Errorf("failed to CreateCompositeKey: %v", err)
 	}
 
 	nftBytes, err := json.Marshal(nft)
 	if err != nil {
-		return false, fmt.Errorf("failed to marshal approval: %v", err)
+		return fmt.Errorf("failed to marshal approval: %v", err)
 	}
 
 	err = ctx.GetStub().PutState(nftKey, nftBytes)
 	if err != nil {
-		return false, fmt.Errorf("failed to PutState nftBytes %s: %v", nftBytes, err)
+		return fmt.Errorf("failed to PutState nftBytes %s: %v", nftBytes, err)
 	}
 
 	// Remove a composite key from the balance of the current owner
 	balanceKeyFrom, err := ctx.GetStub().CreateCompositeKey(balancePrefix, []string{from, tokenId})
 	if err != nil {
-		return false, fmt.Errorf("failed to CreateCompositeKey from: %v", err)
+		return fmt.Errorf("failed to CreateCompositeKey from: %v", err)
 	}
 
 	err = ctx.GetStub().DelState(balanceKeyFrom)
 	if err != nil {
-		return false, fmt.Errorf("failed to DelState balanceKeyFrom %s: %v", nftBytes, err)
+		return fmt.Errorf("failed to DelState balanceKeyFrom %s: %v", nftBytes, err)
 	}
 
 	// Save a composite key to count the balance of a new owner
 	balanceKeyTo, err := ctx.GetStub().CreateCompositeKey(balancePrefix, []string{to, tokenId})
 	if err != nil {
-		return false, fmt.Errorf("failed to CreateCompositeKey to: %v", err)
+		return fmt.Errorf("failed to CreateCompositeKey to: %v", err)
 	}
 	err = ctx.GetStub().PutState(balanceKeyTo, []byte{0})
 	if err != nil {
-		return false, fmt.Errorf("failed to PutState balanceKeyTo %s: %v", balanceKeyTo, err)
-	}
-
-	// Emit the Transfer event
-	transferEvent := new(Transfer)
-	transferEvent.From = from
-	transferEvent.To = to
-	transferEvent.TokenId = tokenId
-
-	transferEventBytes, err := json.Marshal(transferEvent)
-	if err != nil {
-		return false, fmt.Errorf("failed to marshal transferEventBytes: %v", err)
+		return fmt.Errorf("failed to PutState balanceKeyTo %s: %v", balanceKeyTo, err)
 	}
 
-	err = ctx.GetStub().SetEvent("Transfer", transferEventBytes)
-	if err != nil {
-		return false, fmt.Errorf("failed to SetEvent transferEventBytes %s: %v", transferEventBytes, err)
-	}
-	return true, nil
+	return nil
 }
 
 // ============== ERC721 metadata extension ===============
@@ -568,9 +579,13 @@ func (c *TokenERC721Contract) OwnerMSPID(ctx contractapi.TransactionContextInter
 // Mint a new non-fungible token
 // param {String} tokenId Unique ID of the non-fungible token to be minted
 // param {String} tokenURI URI containing metadata of the minted non-fungible token
+// param {String} metadata JSON metadata of the card, empty for a card of the service named by tokenURI
+// param {Number} notBefore Unix time from which the card is valid, 0 for no start
+// param {Number} notAfter Unix time until which the card is valid, 0 for no expiry
+// param {Number} usageAllowance Number of uses the card allows, 0 for unmetered
 // returns {Object} Return the non-fungible token object
 
-func (c *TokenERC721Contract) MintWithTokenURI(ctx contractapi.TransactionContextInterface, tokenId string, tokenURI string) (*Nft, error) {
+func (c *TokenERC721Contract) MintWithTokenURI(ctx contractapi.TransactionContextInterface, tokenId string, tokenURI string, metadata string, notBefore int64, notAfter int64, usageAllowance int) (*Nft, error) {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -581,37 +596,87 @@ func (c *TokenERC721Contract) MintWithTokenURI(ctx contractapi.TransactionContex
 		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
-	// Check minter authorization
 	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get clientMSPID: %v", err)
 	}
 
-	ownerMSPID, err := c.OwnerMSPID(ctx)
+	// Get ID of submitting client identity
+	minter, err := GetClientIdentity(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get ownerMSPID: %v", err)
+		return nil, fmt.Errorf("failed to GetClientIdentity: %v", err)
 	}
-	if clientMSPID != ownerMSPID {
-		return nil, fmt.Errorf("client is not authorized to set the name and symbol of the token")
+
+	nft, err := _mintNFT(ctx, clientMSPID, minter, minter, tokenId, tokenURI, metadata, notBefore, notAfter, usageAllowance)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get ID of submitting client identity
-	minter, err := GetClientIdentity(ctx)
+	// Emit the Transfer event
+	transferEvent := new(Transfer)
+	transferEvent.From = "0x0"
+	transferEvent.To = minter
+	transferEvent.TokenId = tokenId
+
+	transferEventBytes, err := json.Marshal(transferEvent)
 	if err != nil {
-		return nil, fmt.Errorf("failed to GetClientIdentity: %v", err)
+		return nil, fmt.Errorf("failed to marshal transferEventBytes: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("Transfer", transferEventBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to SetEvent transferEventBytes %s: %v", transferEventBytes, err)
 	}
 
+	return nft, nil
+}
+
+// _mintNFT mints a non-fungible token to an owner, issued by a client of the given MSP.
+// It does not emit the Transfer event.
+func _mintNFT(ctx contractapi.TransactionContextInterface, clientMSPID string, issuer string, owner string, tokenId string, tokenURI string, metadata string, notBefore int64, notAfter int64, usageAllowance int) (*Nft, error) {
 	// Check if the token to be minted does not exist
 	exists := _nftExists(ctx, tokenId)
 	if exists {
-		return nil, fmt.Errorf("the token %s is already minted.: %v", tokenId, err)
+		return nil, fmt.Errorf("the token %s is already minted", tokenId)
+	}
+
+	if notAfter != 0 && notAfter < notBefore {
+		return nil, fmt.Errorf("the card would expire at %d before it is valid at %d", notAfter, notBefore)
+	}
+	if usageAllowance < 0 {
+		return nil, fmt.Errorf("the usage allowance must not be negative")
+	}
+
+	cardMetadata, err := _parseCardMetadata(metadata, tokenURI, clientMSPID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cards can only be minted for active services in the registry
+	err = _assertServiceActive(ctx, cardMetadata.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check minter authorization for the service
+	isMinter, err := _isMinter(ctx, clientMSPID, cardMetadata.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMinter {
+		return nil, fmt.Errorf("client from org %s is not authorized to mint cards for service %s", clientMSPID, cardMetadata.ServiceID)
 	}
 
 	// Add a non-fungible token
 	nft := new(Nft)
 	nft.TokenId = tokenId
-	nft.Owner = minter
+	nft.Owner = owner
 	nft.TokenURI = tokenURI
+	nft.Issuer = issuer
+	nft.NotBefore = notBefore
+	nft.NotAfter = notAfter
+	nft.UsageAllowance = usageAllowance
+	nft.Metadata = cardMetadata
 
 	nftKey, err := ctx.GetStub().CreateCompositeKey(nftPrefix, []string{tokenId})
 	if err != nil {
@@ -632,7 +697,7 @@ func (c *TokenERC721Contract) MintWithTokenURI(ctx contractapi.TransactionContex
 	// composite key query to find and count all records matching balance.owner.*
 	// An empty value would represent a delete, so we simply insert the null character.
 
-	balanceKey, err := ctx.GetStub().CreateCompositeKey(balancePrefix, []string{minter, tokenId})
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(balancePrefix, []string{owner, tokenId})
 	if err != nil {
 		return nil, fmt.Errorf("failed to CreateCompositeKey to balanceKey: %v", err)
 	}
@@ -642,22 +707,6 @@ func (c *TokenERC721Contract) MintWithTokenURI(ctx contractapi.TransactionContex
 		return nil, fmt.Errorf("failed to PutState balanceKey %s: %v", nftBytes, err)
 	}
 
-	// Emit the Transfer event
-	transferEvent := new(Transfer)
-	transferEvent.From = "0x0"
-	transferEvent.To = minter
-	transferEvent.TokenId = tokenId
-
-	transferEventBytes, err := json.Marshal(transferEvent)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal transferEventBytes: %v", err)
-	}
-
-	err = ctx.GetStub().SetEvent("Transfer", transferEventBytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to SetEvent transferEventBytes %s: %v", transferEventBytes, err)
-	}
-
 	return nft, nil
 }
 
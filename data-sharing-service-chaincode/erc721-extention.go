@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -93,3 +95,181 @@ func (c *TokenERC721Contract) BalanceOfByURIPrefix(ctx contractapi.TransactionCo
 	}
 	return balance
 }
+
+// TokensOfOwnerWithPagination returns one page of the non-fungible tokens assigned to an owner
+// param owner {String} An owner for whom to list the tokens
+// param pageSize {Number} The maximum number of tokens to return
+// param bookmark {String} The bookmark returned by the previous page, empty for the first page
+// returns {Object} Return the tokens of this page and the bookmark of the next page
+func (c *TokenERC721Contract) TokensOfOwnerWithPagination(ctx contractapi.TransactionContextInterface, owner string, pageSize int32, bookmark string) (*PaginatedNftResult, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// There is a key record for every non-fungible token in the format of balancePrefix.owner.tokenId.
+	iterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(balancePrefix, []string{owner}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKeyWithPagination: %v", err)
+	}
+	defer iterator.Close()
+
+	nfts := []*Nft{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next balance key: %v", err)
+		}
+
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to SplitCompositeKey %s: %v", response.Key, err)
+		}
+
+		nft, err := _readNFT(ctx, compositeKeyParts[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to _readNFT: %v", err)
+		}
+		nfts = append(nfts, nft)
+	}
+
+	return &PaginatedNftResult{
+		Records:             nfts,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// TokensWithPagination returns one page of all the non-fungible tokens tracked by this contract
+// param pageSize {Number} The maximum number of tokens to return
+// param bookmark {String} The bookmark returned by the previous page, empty for the first page
+// returns {Object} Return the tokens of this page and the bookmark of the next page
+func (c *TokenERC721Contract) TokensWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PaginatedNftResult, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// There is a key record for every non-fungible token in the format of nftPrefix.tokenId.
+	iterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(nftPrefix, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKeyWithPagination: %v", err)
+	}
+	defer iterator.Close()
+
+	nfts := []*Nft{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next nft: %v", err)
+		}
+
+		nft := new(Nft)
+		err = json.Unmarshal(response.Value, nft)
+		if err != nil {
+			return nil, fmt.Errorf("failed to Unmarshal nftBytes (%s): %v", response.Key, err)
+		}
+		nfts = append(nfts, nft)
+	}
+
+	return &PaginatedNftResult{
+		Records:             nfts,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// GetTokenHistory returns every version of a non-fungible token, oldest first,
+// which is the ownership and approval trail of the token from mint to burn
+// param {String} tokenId The identifier for a non-fungible token
+// returns {Array} Return the versions of the token with the transaction that wrote each of them
+func (c *TokenERC721Contract) GetTokenHistory(ctx contractapi.TransactionContextInterface, tokenId string) ([]*NftHistoryRecord, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	nftKey, err := ctx.GetStub().CreateCompositeKey(nftPrefix, []string{tokenId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", tokenId, err)
+	}
+
+	iterator, err := ctx.GetStub().GetHistoryForKey(nftKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetHistoryForKey %s: %v", tokenId, err)
+	}
+	defer iterator.Close()
+
+	history := []*NftHistoryRecord{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next history record: %v", err)
+		}
+
+		// A burnt token has no value
+		var nft *Nft
+		if len(response.Value) > 0 {
+			nft = new(Nft)
+			err = json.Unmarshal(response.Value, nft)
+			if err != nil {
+				return nil, fmt.Errorf("failed to Unmarshal nftBytes (%s %s): %v", nftKey, response.Value, err)
+			}
+		}
+
+		history = append(history, &NftHistoryRecord{
+			TxId:      response.TxId,
+			Timestamp: response.Timestamp.GetSeconds(),
+			IsDelete:  response.IsDelete,
+			Record:    nft,
+		})
+	}
+
+	// The history is returned newest first, reverse it to read as a trail
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	return history, nil
+}
+
+// TokenOfOwnerByURI finds a non-fungible token of an owner with the given URI that is valid at the time of the transaction
+// param owner {String} An owner whose tokens to search
+// param tokenURI {String} The URI the token must have
+// returns {String} Return the first matching token, or an error if the owner holds none
+func (c *TokenERC721Contract) TokenOfOwnerByURI(ctx contractapi.TransactionContextInterface, owner string, tokenURI string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	tokenId, err := _validTokenOfOwner(ctx, owner, func(nft *Nft) bool { return nft.TokenURI == tokenURI })
+	if err != nil {
+		return "", err
+	}
+	if tokenId == "" {
+		return "", fmt.Errorf("%s holds no valid token with URI %s", owner, tokenURI)
+	}
+
+	return tokenId, nil
+}
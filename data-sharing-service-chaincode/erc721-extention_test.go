@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readPages pages through a paginated token listing and returns the ids of every token it returned
+func (n *testNetwork) readPages(t *testing.T, client *testClient, function string, pageSize int, args ...string) []string {
+	tokenIds := []string{}
+	bookmark := ""
+	for {
+		page := new(PaginatedNftResult)
+		pageArgs := append(append([]string{}, args...), fmt.Sprint(pageSize), bookmark)
+		require.NoError(t, json.Unmarshal(n.mustInvoke(t, client, function, pageArgs...), page))
+		require.LessOrEqual(t, len(page.Records), pageSize)
+		require.Equal(t, int32(len(page.Records)), page.FetchedRecordsCount)
+
+		for _, nft := range page.Records {
+			tokenIds = append(tokenIds, nft.TokenId)
+		}
+		if page.Bookmark == "" {
+			return tokenIds
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+func TestTokensWithPagination(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	for i := 1; i <= 5; i++ {
+		network.mintTo(t, user, fmt.Sprintf("card%d", i), 0, 0)
+	}
+	network.mustInvoke(t, network.minter, "MintWithTokenURI", "card6", testServiceID, "", "0", "0", "0")
+
+	tokenIds := network.readPages(t, user, "TokensWithPagination", 2)
+	require.Equal(t, []string{"card1", "card2", "card3", "card4", "card5", "card6"}, tokenIds)
+
+	tokenIds = network.readPages(t, user, "TokensOfOwnerWithPagination", 2, network.id(t, user))
+	require.Equal(t, []string{"card1", "card2", "card3", "card4", "card5"}, tokenIds)
+
+	tokenIds = network.readPages(t, user, "TokensOfOwnerWithPagination", 2, network.id(t, network.ca.enroll(t, "user2", nil)))
+	require.Empty(t, tokenIds)
+}
+
+func TestGetTokenHistory(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	network.mintTo(t, user, "card1", 0, 0)
+	network.mustInvoke(t, user, "Burn", "card1")
+
+	var history []*NftHistoryRecord
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, user, "GetTokenHistory", "card1"), &history))
+	require.Len(t, history, 3)
+	require.Equal(t, network.id(t, network.minter), history[0].Record.Owner)
+	require.Equal(t, network.id(t, user), history[1].Record.Owner)
+	require.True(t, history[2].IsDelete)
+	require.Nil(t, history[2].Record)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// cardMetadataSchema is the JSON schema the metadata of a card must match when it is minted.
+// The issuer is not part of it, it is always the MSP of the minter.
+const cardMetadataSchema = `{
+	"type": "object",
+	"properties": {
+		"serviceID": {"type": "string", "minLength": 1},
+		"tier": {"type": "string"},
+		"scopes": {"type": "array", "items": {"type": "string", "minLength": 1}, "uniqueItems": true},
+		"attributes": {"type": "object", "additionalProperties": {"type": "string"}}
+	},
+	"required": ["serviceID"],
+	"additionalProperties": false
+}`
+
+// GetCardMetadata returns the metadata of a card
+// param {String} tokenId The identifier for a non-fungible token
+// returns {Object} Return the service, tier, scopes, issuer and attributes of the card
+func (c *TokenERC721Contract) GetCardMetadata(ctx contractapi.TransactionContextInterface, tokenId string) (*CardMetadata, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if !_nftExists(ctx, tokenId) {
+		return nil, fmt.Errorf("the token %s does not exist", tokenId)
+	}
+
+	nft, err := _readNFT(ctx, tokenId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to _readNFT: %v", err)
+	}
+
+	return _cardMetadata(nft), nil
+}
+
+// BalanceOfByService counts the cards of an owner for a service
+// param owner {String} An owner for whom to count the cards
+// param serviceID {String} The service the cards must be for
+// param onlyValid {Boolean} Whether to count only the cards valid at the time of the transaction
+// returns {Number} Return the number of matching cards
+func (c *TokenERC721Contract) BalanceOfByService(ctx contractapi.TransactionContextInterface, owner string, serviceID string, onlyValid bool) (int, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	now, err := _txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	nfts, err := _tokensOfOwner(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	balance := 0
+	for _, nft := range nfts {
+		if _cardMetadata(nft).ServiceID == serviceID && (!onlyValid || _isCardValidAt(nft, now)) {
+			balance++
+		}
+	}
+
+	return balance, nil
+}
+
+// BalanceOfByTier counts the cards of an owner for a tier of a service
+// param owner {String} An owner for whom to count the cards
+// param serviceID {String} The service the cards must be for
+// param tier {String} The tier the cards must have
+// param onlyValid {Boolean} Whether to count only the cards valid at the time of the transaction
+// returns {Number} Return the number of matching cards
+func (c *TokenERC721Contract) BalanceOfByTier(ctx contractapi.TransactionContextInterface, owner string, serviceID string, tier string, onlyValid bool) (int, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	now, err := _txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	nfts, err := _tokensOfOwner(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	balance := 0
+	for _, nft := range nfts {
+		metadata := _cardMetadata(nft)
+		if metadata.ServiceID == serviceID && metadata.Tier == tier && (!onlyValid || _isCardValidAt(nft, now)) {
+			balance++
+		}
+	}
+
+	return balance, nil
+}
+
+// TokensOfOwnerByService returns the cards of an owner for a service
+// param owner {String} An owner whose cards to list
+// param serviceID {String} The service the cards must be for
+// returns {Array} Return the matching cards
+func (c *TokenERC721Contract) TokensOfOwnerByService(ctx contractapi.TransactionContextInterface, owner string, serviceID string) ([]*Nft, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	nfts, err := _tokensOfOwner(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	cards := []*Nft{}
+	for _, nft := range nfts {
+		if _cardMetadata(nft).ServiceID == serviceID {
+			cards = append(cards, nft)
+		}
+	}
+
+	return cards, nil
+}
+
+// TokenOfOwnerByService finds a card of an owner for a service that is valid at the time of the transaction.
+// The query chaincode calls it to check that a query initiator holds a card for the service.
+// param owner {String} An owner whose cards to search
+// param serviceID {String} The service the card must be for
+// returns {String} Return the first matching card, or an error if the owner holds none
+func (c *TokenERC721Contract) TokenOfOwnerByService(ctx contractapi.TransactionContextInterface, owner string, serviceID string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	tokenId, err := _validTokenOfOwner(ctx, owner, func(nft *Nft) bool { return _cardMetadata(nft).ServiceID == serviceID })
+	if err != nil {
+		return "", err
+	}
+	if tokenId == "" {
+		return "", fmt.Errorf("%s holds no valid card for service %s", owner, serviceID)
+	}
+
+	return tokenId, nil
+}
+
+// _parseCardMetadata validates the metadata of a card against cardMetadataSchema.
+// Empty metadata makes a card of the service named by the token URI.
+func _parseCardMetadata(metadata string, tokenURI string, issuerMSPID string) (*CardMetadata, error) {
+	cardMetadata := new(CardMetadata)
+	if metadata == "" {
+		cardMetadata.ServiceID = tokenURI
+	} else {
+		result, err := gojsonschema.Validate(gojsonschema.NewStringLoader(cardMetadataSchema), gojsonschema.NewStringLoader(metadata))
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate card metadata: %v", err)
+		}
+		if !result.Valid() {
+			var problems []string
+			for _, resultError := range result.Errors() {
+				problems = append(problems, resultError.String())
+			}
+			return nil, fmt.Errorf("invalid card metadata: %s", strings.Join(problems, "; "))
+		}
+
+		err = json.Unmarshal([]byte(metadata), cardMetadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to Unmarshal card metadata: %v", err)
+		}
+	}
+
+	cardMetadata.Issuer = issuerMSPID
+	if cardMetadata.Scopes == nil {
+		cardMetadata.Scopes = []string{}
+	}
+	if cardMetadata.Attributes == nil {
+		cardMetadata.Attributes = map[string]string{}
+	}
+
+	return cardMetadata, nil
+}
+
+// _cardMetadata returns the metadata of a card, which for cards minted without metadata
+// only names the service of the card by its token URI
+func _cardMetadata(nft *Nft) *CardMetadata {
+	if nft.Metadata != nil {
+		return nft.Metadata
+	}
+
+	return &CardMetadata{
+		ServiceID:  nft.TokenURI,
+		Scopes:     []string{},
+		Attributes: map[string]string{},
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenOfOwnerByService(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	owner := network.id(t, user)
+	network.mintTo(t, user, "expired", 0, 1)
+
+	_, err := network.invoke(t, user, "TokenOfOwnerByService", owner, testServiceID)
+	require.EqualError(t, err, fmt.Sprintf("%s holds no valid card for service %s", owner, testServiceID))
+
+	network.mintTo(t, user, "card1", 0, 0)
+	require.Equal(t, "card1", string(network.mustInvoke(t, user, "TokenOfOwnerByService", owner, testServiceID)))
+
+	_, err = network.invoke(t, user, "TokenOfOwnerByService", owner, "service2")
+	require.EqualError(t, err, fmt.Sprintf("%s holds no valid card for service service2", owner))
+}
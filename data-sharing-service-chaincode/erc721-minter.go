@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType name for the minter role
+const minterPrefix = "minter"
+
+// GrantMinter allows the clients of an MSP to mint cards. Granting again replaces the services of the minter.
+// Only clients of the owner MSP may call it, and the owner MSP can always mint.
+// param {String} mspID The MSP to grant the minter role to
+// param {Array} services The services the MSP may mint cards for, empty for every service
+// returns {Object} Return the minter
+func (c *TokenERC721Contract) GrantMinter(ctx contractapi.TransactionContextInterface, mspID string, services []string) (*Minter, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = c.assertOwnerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if mspID == "" {
+		return nil, fmt.Errorf("the MSP ID must not be empty")
+	}
+	if services == nil {
+		services = []string{}
+	}
+
+	minter := new(Minter)
+	minter.MSPID = mspID
+	minter.Services = services
+
+	minterKey, err := ctx.GetStub().CreateCompositeKey(minterPrefix, []string{mspID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey minterKey: %v", err)
+	}
+
+	minterBytes, err := json.Marshal(minter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal minter: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(minterKey, minterBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to PutState minterBytes %s: %v", minterBytes, err)
+	}
+
+	err = _emitMinterChange(ctx, mspID, services, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return minter, nil
+}
+
+// RevokeMinter withdraws the minter role from an MSP. Cards already minted are kept.
+// Only clients of the owner MSP may call it.
+// param {String} mspID The MSP to revoke the minter role from
+// returns {Boolean} Return whether the revoke was successful or not
+func (c *TokenERC721Contract) RevokeMinter(ctx contractapi.TransactionContextInterface, mspID string) (bool, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = c.assertOwnerMSP(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	minter, err := _readMinter(ctx, mspID)
+	if err != nil {
+		return false, err
+	}
+	if minter == nil {
+		return false, fmt.Errorf("%s is not a minter", mspID)
+	}
+
+	minterKey, err := ctx.GetStub().CreateCompositeKey(minterPrefix, []string{mspID})
+	if err != nil {
+		return false, fmt.Errorf("failed to CreateCompositeKey minterKey: %v", err)
+	}
+
+	err = ctx.GetStub().DelState(minterKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to DelState minterKey: %v", err)
+	}
+
+	err = _emitMinterChange(ctx, mspID, minter.Services, false)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// IsMinter checks whether the clients of an MSP may mint cards for a service
+// param {String} mspID The MSP to check
+// param {String} serviceID The service to mint cards for
+// returns {Boolean} Return whether the MSP may mint cards for the service
+func (c *TokenERC721Contract) IsMinter(ctx contractapi.TransactionContextInterface, mspID string, serviceID string) (bool, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return _isMinter(ctx, mspID, serviceID)
+}
+
+// ListMinters returns the MSPs granted the minter role, not including the owner MSP
+// returns {Array} Return the minters and the services they may mint cards for
+func (c *TokenERC721Contract) ListMinters(ctx contractapi.TransactionContextInterface) ([]*Minter, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(minterPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKey: %v", err)
+	}
+	defer iterator.Close()
+
+	minters := []*Minter{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next minter: %v", err)
+		}
+
+		minter := new(Minter)
+		err = json.Unmarshal(response.Value, minter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to Unmarshal minterBytes (%s): %v", response.Key, err)
+		}
+		minters = append(minters, minter)
+	}
+
+	return minters, nil
+}
+
+// assertOwnerMSP checks that the client belongs to the owner MSP of the contract
+func (c *TokenERC721Contract) assertOwnerMSP(ctx contractapi.TransactionContextInterface) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get clientMSPID: %v", err)
+	}
+
+	ownerMSPID, err := c.OwnerMSPID(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get ownerMSPID: %v", err)
+	}
+	if clientMSPID != ownerMSPID {
+		return fmt.Errorf("client from org %s is not the owner of the contract", clientMSPID)
+	}
+
+	return nil
+}
+
+// _isMinter checks whether an MSP is the owner MSP or a minter that may mint cards for the service
+func _isMinter(ctx contractapi.TransactionContextInterface, mspID string, serviceID string) (bool, error) {
+	ownerMSPID, err := ctx.GetStub().GetState(ownerMSPIDKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to get Owner MSPID: %v", err)
+	}
+	if string(ownerMSPID) == mspID {
+		return true, nil
+	}
+
+	minter, err := _readMinter(ctx, mspID)
+	if err != nil {
+		return false, err
+	}
+	if minter == nil {
+		return false, nil
+	}
+	if len(minter.Services) == 0 {
+		return true, nil
+	}
+
+	for _, service := range minter.Services {
+		if service == serviceID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func _readMinter(ctx contractapi.TransactionContextInterface, mspID string) (*Minter, error) {
+	minterKey, err := ctx.GetStub().CreateCompositeKey(minterPrefix, []string{mspID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey minterKey: %v", err)
+	}
+
+	minterBytes, err := ctx.GetStub().GetState(minterKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetState minterKey: %v", err)
+	}
+	if len(minterBytes) == 0 {
+		return nil, nil
+	}
+
+	minter := new(Minter)
+	err = json.Unmarshal(minterBytes, minter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Unmarshal minterBytes (%s %s): %v", minterKey, minterBytes, err)
+	}
+
+	return minter, nil
+}
+
+// _emitMinterChange emits the MinterChange event
+func _emitMinterChange(ctx contractapi.TransactionContextInterface, mspID string, services []string, granted bool) error {
+	changeEvent := new(MinterChange)
+	changeEvent.MSPID = mspID
+	changeEvent.Services = services
+	changeEvent.Granted = granted
+
+	changeEventBytes, err := json.Marshal(changeEvent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal changeEventBytes: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("MinterChange", changeEventBytes)
+	if err != nil {
+		return fmt.Errorf("failed to SetEvent changeEventBytes %s: %v", changeEventBytes, err)
+	}
+
+	return nil
+}
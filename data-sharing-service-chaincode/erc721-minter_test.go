@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrantAndRevokeMinter(t *testing.T) {
+	network := newTestNetwork(t)
+	minter := network.ca.enroll(t, "minter2", map[string]string{roleAttribute: "minter"})
+	minter.mspID = "Org2MSP"
+	network.mustInvoke(t, network.minter, "RegisterService", "service2", "another test service", "[]", "", "0", "0")
+
+	_, err := network.invoke(t, minter, "GrantMinter", "Org2MSP", "[]")
+	require.EqualError(t, err, "client from org Org2MSP is not the owner of the contract")
+	_, err = network.invoke(t, minter, "MintWithTokenURI", "card1", testServiceID, "", "0", "0", "0")
+	require.EqualError(t, err, "client from org Org2MSP is not authorized to mint cards for service "+testServiceID)
+
+	// A minter may only mint cards for the services it was granted
+	network.mustInvoke(t, network.minter, "GrantMinter", "Org2MSP", `["`+testServiceID+`"]`)
+	require.Equal(t, "true", string(network.mustInvoke(t, minter, "IsMinter", "Org2MSP", testServiceID)))
+	require.Equal(t, "false", string(network.mustInvoke(t, minter, "IsMinter", "Org2MSP", "service2")))
+	require.Equal(t, "true", string(network.mustInvoke(t, minter, "IsMinter", testMSPID, "service2")))
+	network.mustInvoke(t, minter, "MintWithTokenURI", "card1", testServiceID, "", "0", "0", "0")
+	_, err = network.invoke(t, minter, "MintWithTokenURI", "card2", "service2", "", "0", "0", "0")
+	require.EqualError(t, err, "client from org Org2MSP is not authorized to mint cards for service service2")
+
+	// Granting again replaces the services
+	network.mustInvoke(t, network.minter, "GrantMinter", "Org2MSP", "[]")
+	network.mustInvoke(t, minter, "MintWithTokenURI", "card2", "service2", "", "0", "0", "0")
+
+	var minters []*Minter
+	require.NoError(t, json.Unmarshal(network.mustInvoke(t, minter, "ListMinters"), &minters))
+	require.Equal(t, []*Minter{{MSPID: "Org2MSP", Services: []string{}}}, minters)
+
+	network.mustInvoke(t, network.minter, "RevokeMinter", "Org2MSP")
+	_, err = network.invoke(t, network.minter, "RevokeMinter", "Org2MSP")
+	require.EqualError(t, err, "Org2MSP is not a minter")
+	require.Equal(t, "false", string(network.mustInvoke(t, minter, "IsMinter", "Org2MSP", testServiceID)))
+	_, err = network.invoke(t, minter, "MintWithTokenURI", "card3", testServiceID, "", "0", "0", "0")
+	require.EqualError(t, err, "client from org Org2MSP is not authorized to mint cards for service "+testServiceID)
+
+	// Cards already minted are kept
+	require.Equal(t, network.id(t, minter), string(network.mustInvoke(t, minter, "OwnerOf", "card1")))
+}
+
+func TestRenewCardRequiresActiveMinter(t *testing.T) {
+	network := newTestNetwork(t)
+	minter := network.ca.enroll(t, "minter2", map[string]string{roleAttribute: "minter"})
+	minter.mspID = "Org2MSP"
+	unprivileged := network.ca.enroll(t, "user1", nil)
+	unprivileged.mspID = "Org2MSP"
+	notAfter := fmt.Sprint(time.Now().Add(time.Hour).Unix())
+
+	network.mustInvoke(t, network.minter, "GrantMinter", "Org2MSP", "[]")
+	network.mustInvoke(t, minter, "MintWithTokenURI", "card1", testServiceID, "", "0", "0", "0")
+	network.mustInvoke(t, minter, "RenewCard", "card1", notAfter)
+
+	// Only the issuer renews, and only with the minter role in its certificate
+	_, err := network.invoke(t, network.minter, "RenewCard", "card1", notAfter)
+	require.EqualError(t, err, "the sender is not the issuer of card card1")
+	_, err = network.invoke(t, unprivileged, "RenewCard", "card1", notAfter)
+	require.Error(t, err)
+
+	network.mustInvoke(t, network.minter, "RevokeMinter", "Org2MSP")
+	_, err = network.invoke(t, minter, "RenewCard", "card1", notAfter)
+	require.EqualError(t, err, "client from org Org2MSP is not authorized to mint cards for service "+testServiceID)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/huyiwen/data-sharing/authz"
+)
+
+// Define the certificate attribute that carries the role of a client
+const roleAttribute = "role"
+
+// Minters carry role=minter on top of belonging to a minter org, and service operators carry role=service
+var minterPolicy = authz.Require(roleAttribute + "=minter")
+var serviceClientPolicy = authz.Require(roleAttribute + "=service")
+
+// cardPolicies declares the certificate attributes the clients of each function of TokenERC721Contract
+// must carry. They are checked before the function runs.
+var cardPolicies = authz.Policies{
+	"ConsumeUsage":     serviceClientPolicy,
+	"MintBatch":        minterPolicy,
+	"MintWithTokenURI": minterPolicy,
+	"RenewCard":        minterPolicy,
+}
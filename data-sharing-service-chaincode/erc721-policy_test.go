@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMintWithTokenURIRequiresMinterRole(t *testing.T) {
+	network := newTestNetwork(t)
+
+	// Clients of the owner MSP still need the role to mint
+	for _, client := range []*testClient{
+		network.ca.enroll(t, "user1", nil),
+		network.ca.enroll(t, "operator", map[string]string{roleAttribute: "service"}),
+	} {
+		_, err := network.invoke(t, client, "MintWithTokenURI", "card1", testServiceID, "", "0", "0", "0")
+		require.EqualError(t, err, "permission denied for MintWithTokenURI: the client does not carry the attribute role=minter")
+	}
+	_, err := network.invoke(t, network.minter, "OwnerOf", "card1")
+	require.Error(t, err)
+
+	network.mustInvoke(t, network.minter, "MintWithTokenURI", "card1", testServiceID, "", "0", "0", "0")
+}
+
+func TestConsumeUsageRequiresServiceRole(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	network.mustInvoke(t, network.minter, "SetServiceOperator", testServiceID, network.id(t, user))
+	network.mintTo(t, user, "card1", 0, 0)
+
+	_, err := network.invoke(t, user, "ConsumeUsage", "card1", "1")
+	require.EqualError(t, err, "permission denied for ConsumeUsage: the client does not carry the attribute role=service")
+}
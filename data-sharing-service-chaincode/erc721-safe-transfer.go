@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for the accounts and receiver contracts that may be sent tokens safely
+const accountPrefix = "account"
+const receiverPrefix = "receiver"
+
+// Receiver contracts are addressed as chaincode::<chaincode name>
+const receiverIdentityPrefix = "chaincode::"
+
+// A receiver contract accepts a token by returning true from this function
+const receiverCallback = "OnCardReceived"
+
+// RegisterAccount registers the identity of the submitting client, so that it can be sent tokens with SafeTransferFrom
+// returns {String} Return the registered account
+func (c *TokenERC721Contract) RegisterAccount(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	account, err := GetClientIdentity(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to GetClientIdentity: %v", err)
+	}
+
+	accountKey, err := ctx.GetStub().CreateCompositeKey(accountPrefix, []string{account})
+	if err != nil {
+		return "", fmt.Errorf("failed to CreateCompositeKey accountKey: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(accountKey, []byte{'\u0000'})
+	if err != nil {
+		return "", fmt.Errorf("failed to PutState accountKey: %v", err)
+	}
+
+	return account, nil
+}
+
+// RegisterReceiver registers a chaincode that may be sent tokens with SafeTransferFrom.
+// The chaincode must implement OnCardReceived(operator, from, tokenId, data) and return true to accept a token.
+// Only clients of the owner MSP may call it.
+// param {String} chaincodeName The name of the receiver chaincode on this channel
+// returns {String} Return the identity to send tokens to the receiver with
+func (c *TokenERC721Contract) RegisterReceiver(ctx contractapi.TransactionContextInterface, chaincodeName string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = c.assertOwnerMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if chaincodeName == "" {
+		return "", fmt.Errorf("the chaincode name must not be empty")
+	}
+
+	receiverKey, err := ctx.GetStub().CreateCompositeKey(receiverPrefix, []string{chaincodeName})
+	if err != nil {
+		return "", fmt.Errorf("failed to CreateCompositeKey receiverKey: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(receiverKey, []byte{'\u0000'})
+	if err != nil {
+		return "", fmt.Errorf("failed to PutState receiverKey: %v", err)
+	}
+
+	return receiverIdentityPrefix + chaincodeName, nil
+}
+
+// IsRegisteredRecipient checks whether tokens can be sent to an identity with SafeTransferFrom
+// param {String} recipient A client identity or receiver contract identity
+// returns {Boolean} Return whether the recipient is a registered account or receiver contract
+func (c *TokenERC721Contract) IsRegisteredRecipient(ctx contractapi.TransactionContextInterface, recipient string) (bool, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = _validateIdentity(recipient)
+	if err != nil {
+		return false, err
+	}
+
+	return _isRegisteredRecipient(ctx, recipient)
+}
+
+// SafeTransferFrom transfers the ownership of a non-fungible token like TransferFrom, but only to
+// a registered account or to a registered receiver contract that accepts the token
+// param {String} from The current owner of the non-fungible token
+// param {String} to The new owner, a client identity or chaincode::<chaincode name>
+// param {String} tokenId the non-fungible token to transfer
+// param {String} data Opaque data passed to a receiver contract and carried in the Transfer event
+// returns {Boolean} Return whether the transfer was successful or not
+func (c *TokenERC721Contract) SafeTransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, tokenId string, data string) (bool, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = _validateIdentity(from)
+	if err != nil {
+		return false, err
+	}
+	err = _validateIdentity(to)
+	if err != nil {
+		return false, err
+	}
+
+	registered, err := _isRegisteredRecipient(ctx, to)
+	if err != nil {
+		return false, err
+	}
+	if !registered {
+		return false, fmt.Errorf("the recipient %s is not a registered account or receiver", to)
+	}
+
+	// Get ID of submitting client identity
+	sender, err := GetClientIdentity(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to GetClientIdentity: %v", err)
+	}
+
+	err = c._transferNFT(ctx, sender, from, to, tokenId)
+	if err != nil {
+		return false, err
+	}
+
+	// A receiver contract must accept the token, or the whole transfer fails
+	if strings.HasPrefix(to, receiverIdentityPrefix) {
+		chaincodeName := strings.TrimPrefix(to, receiverIdentityPrefix)
+		args := [][]byte{[]byte(receiverCallback), []byte(sender), []byte(from), []byte(tokenId), []byte(data)}
+		response := ctx.GetStub().InvokeChaincode(chaincodeName, args, "")
+		if response.Status != shim.OK {
+			return false, fmt.Errorf("the receiver %s failed to accept token %s: %s", to, tokenId, response.Message)
+		}
+		if string(response.Payload) != "true" {
+			return false, fmt.Errorf("the receiver %s did not accept token %s", to, tokenId)
+		}
+	}
+
+	// Emit the Transfer event
+	transferEvent := new(Transfer)
+	transferEvent.From = from
+	transferEvent.To = to
+	transferEvent.TokenId = tokenId
+	transferEvent.Data = data
+
+	transferEventBytes, err := json.Marshal(transferEvent)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal transferEventBytes: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("Transfer", transferEventBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to SetEvent transferEventBytes %s: %v", transferEventBytes, err)
+	}
+	return true, nil
+}
+
+// _validateIdentity checks that an identity is a client identity in the format of GetClientIdentity
+// or a receiver contract identity
+func _validateIdentity(identity string) error {
+	if strings.HasPrefix(identity, receiverIdentityPrefix) {
+		chaincodeName := strings.TrimPrefix(identity, receiverIdentityPrefix)
+		if chaincodeName == "" || strings.ContainsAny(chaincodeName, ": ") {
+			return fmt.Errorf("malformed receiver identity %q", identity)
+		}
+		return nil
+	}
+
+	// Client identities are x509::<subject>::<issuer>. The distinguished names may hold multi-valued
+	// and escaped attributes such as OU=client+OU=org1 or O=Acme\, Inc., so only their presence is checked.
+	parts := strings.SplitN(identity, "::", 3)
+	if len(parts) != 3 || parts[0] != "x509" || parts[1] == "" || parts[2] == "" {
+		return fmt.Errorf("malformed identity %q, expected x509::<subject>::<issuer> or %s<chaincode name>", identity, receiverIdentityPrefix)
+	}
+
+	return nil
+}
+
+func _isRegisteredRecipient(ctx contractapi.TransactionContextInterface, recipient string) (bool, error) {
+	prefix, name := accountPrefix, recipient
+	if strings.HasPrefix(recipient, receiverIdentityPrefix) {
+		prefix, name = receiverPrefix, strings.TrimPrefix(recipient, receiverIdentityPrefix)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(prefix, []string{name})
+	if err != nil {
+		return false, fmt.Errorf("failed to CreateCompositeKey %s: %v", prefix, err)
+	}
+
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to GetState %s: %v", prefix, err)
+	}
+
+	return len(value) > 0, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateIdentity(t *testing.T) {
+	tests := []struct {
+		identity string
+		wantErr  bool
+	}{
+		{identity: "x509::CN=user1,OU=client::CN=ca.org1.example.com"},
+		{identity: "x509::CN=user1,OU=client+OU=org1+OU=department1::CN=ca.org1.example.com,O=org1.example.com"},
+		{identity: `x509::CN=user1,O=Acme\,Inc.::CN=ca.acme.com,O=Acme\,Inc.`},
+		{identity: "chaincode::receiver"},
+		{identity: "x509::CN=user1,OU=client", wantErr: true},
+		{identity: "x509::::CN=ca.org1.example.com", wantErr: true},
+		{identity: "x509::CN=user1,OU=client::", wantErr: true},
+		{identity: "x.509::CN=user1,OU=client::CN=ca.org1.example.com", wantErr: true},
+		{identity: "CN=user1,OU=client", wantErr: true},
+		{identity: "chaincode::", wantErr: true},
+		{identity: "chaincode::receiver::x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := _validateIdentity(tt.identity)
+		if tt.wantErr {
+			require.Error(t, err, tt.identity)
+		} else {
+			require.NoError(t, err, tt.identity)
+		}
+	}
+}
+
+func TestSafeTransferFromToIdentityWithEscapedComma(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "Acme, Inc.", nil)
+	require.Contains(t, network.id(t, user), `\,`)
+
+	network.mustInvoke(t, user, "RegisterAccount")
+	network.mustInvoke(t, network.minter, "MintWithTokenURI", "card1", testServiceID, "", "0", "0", "0")
+	network.mustInvoke(t, network.minter, "SafeTransferFrom", network.id(t, network.minter), network.id(t, user), "card1", "")
+	require.Equal(t, network.id(t, user), string(network.mustInvoke(t, user, "OwnerOf", "card1")))
+
+	recipients, err := json.Marshal([]string{network.id(t, user)})
+	require.NoError(t, err)
+	network.mustInvoke(t, network.minter, "MintBatch", string(recipients), `["card2"]`, `["`+testServiceID+`"]`)
+}
+
+// lastTransfer returns the last Transfer event emitted, the only event of a transaction that Fabric delivers
+func (n *testNetwork) lastTransfer(t *testing.T) map[string]string {
+	var events []*peer.ChaincodeEvent
+	for len(n.stub.ChaincodeEventsChannel) > 0 {
+		events = append(events, <-n.stub.ChaincodeEventsChannel)
+	}
+	require.NotEmpty(t, events)
+	require.Equal(t, "Transfer", events[len(events)-1].EventName)
+
+	transfer := map[string]string{}
+	require.NoError(t, json.Unmarshal(events[len(events)-1].Payload, &transfer))
+	return transfer
+}
+
+func TestSafeTransferFromCarriesData(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	network.mustInvoke(t, network.minter, "MintWithTokenURI", "card1", testServiceID, "", "0", "0", "0")
+
+	_, err := network.invoke(t, network.minter, "SafeTransferFrom", network.id(t, network.minter), network.id(t, user), "card1", "order-42")
+	require.EqualError(t, err, "the recipient "+network.id(t, user)+" is not a registered account or receiver")
+
+	network.mustInvoke(t, user, "RegisterAccount")
+	network.mustInvoke(t, network.minter, "SafeTransferFrom", network.id(t, network.minter), network.id(t, user), "card1", "order-42")
+	transfer := network.lastTransfer(t)
+	require.Equal(t, network.id(t, user), transfer["to"])
+	require.Equal(t, "order-42", transfer["data"])
+
+	// A transfer without data leaves the field out of its event
+	network.mustInvoke(t, user, "TransferFrom", network.id(t, user), network.id(t, network.minter), "card1")
+	require.NotContains(t, network.lastTransfer(t), "data")
+}
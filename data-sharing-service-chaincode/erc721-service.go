@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Define objectType name for the service registry
+const servicePrefix = "service"
+
+// Define the statuses of a service
+const serviceActive = "active"
+const serviceDeprecated = "deprecated"
+
+// RegisterService adds a service to the registry, provided by the MSP of the client.
+// The client owns the service: the query chaincode pays the price of its queries to the client's credit account.
+// Cards can only be minted for active services in the registry.
+// param {String} serviceID Unique ID of the service
+// param {String} description What the service offers
+// param {Array} backingTables Hashes of the names of the tables the service queries
+// param {String} parameterSchema JSON schema of the parameters of a query against the service, empty for none
+// param {Number} price The price in credits of a query against the service
+// param {Number} pricePerRow The price in credits of every row a query against the service returns
+// returns {Object} Return the registered service
+func (c *TokenERC721Contract) RegisterService(ctx contractapi.TransactionContextInterface, serviceID string, description string, backingTables []string, parameterSchema string, price int, pricePerRow int) (*Service, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if serviceID == "" {
+		return nil, fmt.Errorf("the service ID must not be empty")
+	}
+
+	exists, err := _serviceExists(ctx, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("the service %s is already registered", serviceID)
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clientMSPID: %v", err)
+	}
+
+	owner, err := GetClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	service := new(Service)
+	service.ServiceID = serviceID
+	service.ProviderMSPID = clientMSPID
+	service.OwnerID = owner
+	service.Status = serviceActive
+
+	err = _setServiceDetails(service, description, backingTables, parameterSchema, price, pricePerRow)
+	if err != nil {
+		return nil, err
+	}
+
+	return service, _putService(ctx, service)
+}
+
+// UpdateService replaces the details of an active service. Only clients of the provider MSP may call it.
+// param {String} serviceID Unique ID of the service
+// param {String} description What the service offers
+// param {Array} backingTables Hashes of the names of the tables the service queries
+// param {String} parameterSchema JSON schema of the parameters of a query against the service, empty for none
+// param {Number} price The price in credits of a query against the service
+// param {Number} pricePerRow The price in credits of every row a query against the service returns
+// returns {Object} Return the updated service
+func (c *TokenERC721Contract) UpdateService(ctx contractapi.TransactionContextInterface, serviceID string, description string, backingTables []string, parameterSchema string, price int, pricePerRow int) (*Service, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	service, err := _readProvidedService(ctx, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if service.Status != serviceActive {
+		return nil, fmt.Errorf("the service %s is %s", serviceID, service.Status)
+	}
+
+	err = _setServiceDetails(service, description, backingTables, parameterSchema, price, pricePerRow)
+	if err != nil {
+		return nil, err
+	}
+
+	return service, _putService(ctx, service)
+}
+
+// DeprecateService stops cards from being minted for a service. Cards already minted are kept.
+// Only clients of the provider MSP may call it.
+// param {String} serviceID Unique ID of the service
+// returns {Object} Return the deprecated service
+func (c *TokenERC721Contract) DeprecateService(ctx contractapi.TransactionContextInterface, serviceID string) (*Service, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	service, err := _readProvidedService(ctx, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if service.Status == serviceDeprecated {
+		return nil, fmt.Errorf("the service %s is already deprecated", serviceID)
+	}
+
+	service.Status = serviceDeprecated
+	return service, _putService(ctx, service)
+}
+
+// ReadService returns a service from the registry
+// param {String} serviceID Unique ID of the service
+// returns {Object} Return the service
+func (c *TokenERC721Contract) ReadService(ctx contractapi.TransactionContextInterface, serviceID string) (*Service, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return _readService(ctx, serviceID)
+}
+
+// GetAllServices returns every service in the registry, including deprecated ones
+// returns {Array} Return the services
+func (c *TokenERC721Contract) GetAllServices(ctx contractapi.TransactionContextInterface) ([]*Service, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(servicePrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKey: %v", err)
+	}
+	defer iterator.Close()
+
+	services := []*Service{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next service: %v", err)
+		}
+
+		service := new(Service)
+		err = json.Unmarshal(response.Value, service)
+		if err != nil {
+			return nil, fmt.Errorf("failed to Unmarshal serviceBytes (%s): %v", response.Key, err)
+		}
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+// _assertServiceActive fails unless a service is registered and not deprecated
+func _assertServiceActive(ctx contractapi.TransactionContextInterface, serviceID string) error {
+	service, err := _readService(ctx, serviceID)
+	if err != nil {
+		return err
+	}
+	if service.Status != serviceActive {
+		return fmt.Errorf("the service %s is %s", serviceID, service.Status)
+	}
+
+	return nil
+}
+
+func _setServiceDetails(service *Service, description string, backingTables []string, parameterSchema string, price int, pricePerRow int) error {
+	if price < 0 || pricePerRow < 0 {
+		return fmt.Errorf("prices must not be negative")
+	}
+
+	if parameterSchema != "" {
+		_, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(parameterSchema))
+		if err != nil {
+			return fmt.Errorf("invalid parameter schema: %v", err)
+		}
+	}
+
+	if backingTables == nil {
+		backingTables = []string{}
+	}
+
+	service.Description = description
+	service.BackingTables = backingTables
+	service.ParameterSchema = parameterSchema
+	service.Price = price
+	service.PricePerRow = pricePerRow
+	return nil
+}
+
+// _readProvidedService reads a service and checks that the client belongs to its provider MSP
+func _readProvidedService(ctx contractapi.TransactionContextInterface, serviceID string) (*Service, error) {
+	service, err := _readService(ctx, serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clientMSPID: %v", err)
+	}
+	if clientMSPID != service.ProviderMSPID {
+		return nil, fmt.Errorf("client from org %s is not the provider of service %s", clientMSPID, serviceID)
+	}
+
+	return service, nil
+}
+
+func _serviceExists(ctx contractapi.TransactionContextInterface, serviceID string) (bool, error) {
+	serviceKey, err := ctx.GetStub().CreateCompositeKey(servicePrefix, []string{serviceID})
+	if err != nil {
+		return false, fmt.Errorf("failed to CreateCompositeKey %s: %v", serviceID, err)
+	}
+
+	serviceBytes, err := ctx.GetStub().GetState(serviceKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to GetState %s: %v", serviceID, err)
+	}
+
+	return len(serviceBytes) > 0, nil
+}
+
+func _readService(ctx contractapi.TransactionContextInterface, serviceID string) (*Service, error) {
+	serviceKey, err := ctx.GetStub().CreateCompositeKey(servicePrefix, []string{serviceID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey %s: %v", serviceID, err)
+	}
+
+	serviceBytes, err := ctx.GetStub().GetState(serviceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetState %s: %v", serviceID, err)
+	}
+	if len(serviceBytes) == 0 {
+		return nil, fmt.Errorf("the service %s is not registered", serviceID)
+	}
+
+	service := new(Service)
+	err = json.Unmarshal(serviceBytes, service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Unmarshal serviceBytes (%s %s): %v", serviceKey, serviceBytes, err)
+	}
+
+	return service, nil
+}
+
+// _putService stores a service and emits the Service event
+func _putService(ctx contractapi.TransactionContextInterface, service *Service) error {
+	serviceKey, err := ctx.GetStub().CreateCompositeKey(servicePrefix, []string{service.ServiceID})
+	if err != nil {
+		return fmt.Errorf("failed to CreateCompositeKey %s: %v", service.ServiceID, err)
+	}
+
+	serviceBytes, err := json.Marshal(service)
+	if err != nil {
+		return fmt.Errorf("failed to marshal service: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(serviceKey, serviceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to PutState serviceBytes %s: %v", serviceBytes, err)
+	}
+
+	err = ctx.GetStub().SetEvent("Service", serviceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to SetEvent serviceBytes %s: %v", serviceBytes, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readService reads a service from the registry as the client
+func (n *testNetwork) readService(t *testing.T, client *testClient, serviceID string) *Service {
+	service := new(Service)
+	require.NoError(t, json.Unmarshal(n.mustInvoke(t, client, "ReadService", serviceID), service))
+	return service
+}
+
+func TestRegisterServiceRecordsOwnerAndPrice(t *testing.T) {
+	network := newTestNetwork(t)
+	provider := network.ca.enroll(t, "provider", nil)
+
+	_, err := network.invoke(t, provider, "RegisterService", "service2", "a priced service", "[]", "", "-1", "0")
+	require.EqualError(t, err, "prices must not be negative")
+	_, err = network.invoke(t, provider, "RegisterService", testServiceID, "a priced service", "[]", "", "5", "10")
+	require.EqualError(t, err, "the service service1 is already registered")
+
+	network.mustInvoke(t, provider, "RegisterService", "service2", "a priced service", "[]", "", "5", "10")
+	service := network.readService(t, provider, "service2")
+	require.Equal(t, testMSPID, service.ProviderMSPID)
+	require.Equal(t, network.id(t, provider), service.OwnerID)
+	require.Equal(t, 5, service.Price)
+	require.Equal(t, 10, service.PricePerRow)
+	require.Equal(t, serviceActive, service.Status)
+}
+
+func TestUpdateServiceChangesPrice(t *testing.T) {
+	network := newTestNetwork(t)
+	provider := network.ca.enroll(t, "provider", nil)
+	outsider := network.ca.enroll(t, "outsider", nil)
+	outsider.mspID = "Org2MSP"
+	network.mustInvoke(t, provider, "RegisterService", "service2", "a priced service", "[]", "", "5", "10")
+
+	_, err := network.invoke(t, outsider, "UpdateService", "service2", "a cheaper service", "[]", "", "1", "1")
+	require.EqualError(t, err, "client from org Org2MSP is not the provider of service service2")
+	_, err = network.invoke(t, provider, "UpdateService", "service2", "a cheaper service", "[]", "", "1", "-1")
+	require.EqualError(t, err, "prices must not be negative")
+
+	// Another client of the provider MSP may update the service, but the owner who is paid stays the same
+	network.mustInvoke(t, network.minter, "UpdateService", "service2", "a cheaper service", "[]", "", "1", "2")
+	service := network.readService(t, provider, "service2")
+	require.Equal(t, "a cheaper service", service.Description)
+	require.Equal(t, 1, service.Price)
+	require.Equal(t, 2, service.PricePerRow)
+	require.Equal(t, network.id(t, provider), service.OwnerID)
+
+	network.mustInvoke(t, provider, "DeprecateService", "service2")
+	_, err = network.invoke(t, provider, "UpdateService", "service2", "a cheaper service", "[]", "", "1", "2")
+	require.EqualError(t, err, "the service service2 is deprecated")
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType name for the operators of services
+const operatorPrefix = "operator"
+
+// SetServiceOperator sets the identity that runs a service and meters the usage of its cards.
+// Only clients of the provider MSP of an active service may call it.
+// param {String} serviceID The ID of the service the cards are for
+// param {String} operator The identity of the service client
+// returns {Boolean} Return whether the operator was set
+func (c *TokenERC721Contract) SetServiceOperator(ctx contractapi.TransactionContextInterface, serviceID string, operator string) (bool, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Check that the client provides the service
+	service, err := _readProvidedService(ctx, serviceID)
+	if err != nil {
+		return false, err
+	}
+	if service.Status != serviceActive {
+		return false, fmt.Errorf("the service %s is %s", serviceID, service.Status)
+	}
+
+	operatorKey, err := ctx.GetStub().CreateCompositeKey(operatorPrefix, []string{serviceID})
+	if err != nil {
+		return false, fmt.Errorf("failed to CreateCompositeKey operatorKey: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(operatorKey, []byte(operator))
+	if err != nil {
+		return false, fmt.Errorf("failed to PutState operatorKey: %v", err)
+	}
+
+	return true, nil
+}
+
+// ServiceOperator returns the identity that runs a service
+// param {String} serviceID The ID of the service the cards are for
+// returns {String} Return the identity of the service client
+func (c *TokenERC721Contract) ServiceOperator(ctx contractapi.TransactionContextInterface, serviceID string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	return _readServiceOperator(ctx, serviceID)
+}
+
+// ConsumeUsage uses up part of the allowance of a card. Only the operator of the service the card is for may call it.
+// param {String} tokenId The identifier for a non-fungible token
+// param {Number} amount The number of uses to consume
+// returns {Number} Return the remaining usage of the card, -1 if the card is unmetered
+func (c *TokenERC721Contract) ConsumeUsage(ctx contractapi.TransactionContextInterface, tokenId string, amount int) (int, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if amount <= 0 {
+		return 0, fmt.Errorf("the amount to consume must be positive")
+	}
+
+	if !_nftExists(ctx, tokenId) {
+		return 0, fmt.Errorf("the token %s does not exist", tokenId)
+	}
+
+	nft, err := _readNFT(ctx, tokenId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to _readNFT: %v", err)
+	}
+
+	// Check that the sender operates the service of the card
+	sender, err := GetClientIdentity(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to GetClientIdentity: %v", err)
+	}
+
+	serviceID := _cardMetadata(nft).ServiceID
+	operator, err := _readServiceOperator(ctx, serviceID)
+	if err != nil {
+		return 0, err
+	}
+	if sender != operator {
+		return 0, fmt.Errorf("the sender is not the operator of service %s", serviceID)
+	}
+
+	now, err := _txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !_isCardValidAt(nft, now) {
+		return 0, fmt.Errorf("the card %s is not valid", tokenId)
+	}
+
+	remaining := _remainingUsage(nft)
+	if remaining != -1 {
+		if amount > remaining {
+			return 0, fmt.Errorf("the card %s has %d uses left, cannot consume %d", tokenId, remaining, amount)
+		}
+		remaining -= amount
+	}
+	nft.UsageConsumed += amount
+
+	nftKey, err := ctx.GetStub().CreateCompositeKey(nftPrefix, []string{tokenId})
+	if err != nil {
+		return 0, fmt.Errorf("failed to CreateCompositeKey: %v", err)
+	}
+
+	nftBytes, err := json.Marshal(nft)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal nft: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(nftKey, nftBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to PutState nftBytes %s: %v", nftBytes, err)
+	}
+
+	// Emit the UsageConsumed event
+	usageEvent := new(UsageConsumed)
+	usageEvent.TokenId = tokenId
+	usageEvent.Operator = sender
+	usageEvent.Amount = amount
+	usageEvent.Remaining = remaining
+
+	usageEventBytes, err := json.Marshal(usageEvent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal usageEventBytes: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("UsageConsumed", usageEventBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to SetEvent usageEventBytes %s: %v", usageEventBytes, err)
+	}
+
+	return remaining, nil
+}
+
+// RemainingUsage returns how many uses a card has left
+// param {String} tokenId The identifier for a non-fungible token
+// returns {Number} Return the remaining usage of the card, -1 if the card is unmetered
+func (c *TokenERC721Contract) RemainingUsage(ctx contractapi.TransactionContextInterface, tokenId string) (int, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if !_nftExists(ctx, tokenId) {
+		return 0, fmt.Errorf("the token %s does not exist", tokenId)
+	}
+
+	nft, err := _readNFT(ctx, tokenId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to _readNFT: %v", err)
+	}
+
+	return _remainingUsage(nft), nil
+}
+
+func _remainingUsage(nft *Nft) int {
+	if nft.UsageAllowance == 0 {
+		return -1
+	}
+	if nft.UsageConsumed >= nft.UsageAllowance {
+		return 0
+	}
+	return nft.UsageAllowance - nft.UsageConsumed
+}
+
+func _readServiceOperator(ctx contractapi.TransactionContextInterface, serviceID string) (string, error) {
+	operatorKey, err := ctx.GetStub().CreateCompositeKey(operatorPrefix, []string{serviceID})
+	if err != nil {
+		return "", fmt.Errorf("failed to CreateCompositeKey operatorKey: %v", err)
+	}
+
+	operatorBytes, err := ctx.GetStub().GetState(operatorKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to GetState operatorKey: %v", err)
+	}
+	if operatorBytes == nil {
+		return "", fmt.Errorf("the service %s has no operator", serviceID)
+	}
+
+	return string(operatorBytes), nil
+}
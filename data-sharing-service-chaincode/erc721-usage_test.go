@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// A card minted with metadata belongs to the service named in it, whatever its token URI
+func TestCardWithMetadataBelongsToItsService(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	operator := network.ca.enroll(t, "operator", map[string]string{roleAttribute: "service"})
+	network.mustInvoke(t, network.minter, "RegisterService", "service2", "another test service", "[]", "", "0", "0")
+	network.mustInvoke(t, network.minter, "SetServiceOperator", testServiceID, network.id(t, operator))
+
+	network.mustInvoke(t, network.minter, "MintWithTokenURI", "card1", "https://cards.example.com/card1", `{"serviceID": "`+testServiceID+`"}`, "0", "0", "5")
+	network.mustInvoke(t, network.minter, "TransferFrom", network.id(t, network.minter), network.id(t, user), "card1")
+
+	valid := network.mustInvoke(t, user, "HasValidCard", network.id(t, user), testServiceID)
+	require.Equal(t, "true", string(valid))
+	valid = network.mustInvoke(t, user, "HasValidCard", network.id(t, user), "https://cards.example.com/card1")
+	require.Equal(t, "false", string(valid))
+
+	remaining := network.mustInvoke(t, operator, "ConsumeUsage", "card1", "2")
+	require.Equal(t, "3", string(remaining))
+
+	// The operator of another service cannot meter the card
+	network.mustInvoke(t, network.minter, "SetServiceOperator", testServiceID, network.id(t, network.minter))
+	network.mustInvoke(t, network.minter, "SetServiceOperator", "service2", network.id(t, operator))
+	_, err := network.invoke(t, operator, "ConsumeUsage", "card1", "1")
+	require.EqualError(t, err, "the sender is not the operator of service "+testServiceID)
+}
+
+func TestSetServiceOperatorOnlyByProvider(t *testing.T) {
+	network := newTestNetwork(t)
+	operator := network.ca.enroll(t, "operator", map[string]string{roleAttribute: "service"})
+	outsider := network.ca.enroll(t, "outsider", nil)
+	outsider.mspID = "Org2MSP"
+
+	_, err := network.invoke(t, outsider, "SetServiceOperator", testServiceID, network.id(t, outsider))
+	require.EqualError(t, err, "client from org Org2MSP is not the provider of service "+testServiceID)
+	_, err = network.invoke(t, network.minter, "SetServiceOperator", "service2", network.id(t, operator))
+	require.EqualError(t, err, "the service service2 is not registered")
+
+	network.mustInvoke(t, network.minter, "SetServiceOperator", testServiceID, network.id(t, operator))
+	require.Equal(t, network.id(t, operator), string(network.mustInvoke(t, outsider, "ServiceOperator", testServiceID)))
+
+	network.mustInvoke(t, network.minter, "DeprecateService", testServiceID)
+	_, err = network.invoke(t, network.minter, "SetServiceOperator", testServiceID, network.id(t, network.minter))
+	require.EqualError(t, err, "the service "+testServiceID+" is deprecated")
+}
+
+func TestConsumeUsageMetersCard(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	operator := network.ca.enroll(t, "operator", map[string]string{roleAttribute: "service"})
+	otherOperator := network.ca.enroll(t, "operator2", map[string]string{roleAttribute: "service"})
+	network.mustInvoke(t, network.minter, "MintWithTokenURI", "card1", testServiceID, "", "0", "0", "3")
+	network.mintTo(t, user, "card2", 0, 0)
+
+	_, err := network.invoke(t, operator, "ConsumeUsage", "card1", "1")
+	require.EqualError(t, err, "the service "+testServiceID+" has no operator")
+	network.mustInvoke(t, network.minter, "SetServiceOperator", testServiceID, network.id(t, operator))
+
+	// Only clients with the service role that operate the service may meter its cards
+	_, err = network.invoke(t, user, "ConsumeUsage", "card1", "1")
+	require.Error(t, err)
+	_, err = network.invoke(t, otherOperator, "ConsumeUsage", "card1", "1")
+	require.EqualError(t, err, "the sender is not the operator of service "+testServiceID)
+	_, err = network.invoke(t, operator, "ConsumeUsage", "card1", "0")
+	require.EqualError(t, err, "the amount to consume must be positive")
+
+	require.Equal(t, "3", string(network.mustInvoke(t, user, "RemainingUsage", "card1")))
+	require.Equal(t, "1", string(network.mustInvoke(t, operator, "ConsumeUsage", "card1", "2")))
+	_, err = network.invoke(t, operator, "ConsumeUsage", "card1", "2")
+	require.EqualError(t, err, "the card card1 has 1 uses left, cannot consume 2")
+	require.Equal(t, "0", string(network.mustInvoke(t, operator, "ConsumeUsage", "card1", "1")))
+	require.Equal(t, "0", string(network.mustInvoke(t, user, "RemainingUsage", "card1")))
+
+	// A card without an allowance is unmetered
+	require.Equal(t, "-1", string(network.mustInvoke(t, operator, "ConsumeUsage", "card2", "100")))
+	require.Equal(t, "-1", string(network.mustInvoke(t, user, "RemainingUsage", "card2")))
+}
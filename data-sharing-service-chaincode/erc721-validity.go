@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// IsCardValid checks whether a card is valid at the time of the transaction
+// param {String} tokenId The identifier for a non-fungible token
+// returns {Boolean} Return whether the transaction time is within the validity of the card
+func (c *TokenERC721Contract) IsCardValid(ctx contractapi.TransactionContextInterface, tokenId string) (bool, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if !_nftExists(ctx, tokenId) {
+		return false, fmt.Errorf("the token %s does not exist", tokenId)
+	}
+
+	nft, err := _readNFT(ctx, tokenId)
+	if err != nil {
+		return false, fmt.Errorf("failed to _readNFT: %v", err)
+	}
+
+	now, err := _txTimestamp(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return _isCardValidAt(nft, now), nil
+}
+
+// HasValidCard checks whether an owner holds a card for a service that is valid at the time of the transaction
+// param {String} owner An owner whose tokens to search
+// param {String} serviceID The ID of the service the card is for
+// returns {Boolean} Return whether the owner holds a valid card for the service
+func (c *TokenERC721Contract) HasValidCard(ctx contractapi.TransactionContextInterface, owner string, serviceID string) (bool, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	tokenId, err := _validTokenOfOwner(ctx, owner, func(nft *Nft) bool { return _cardMetadata(nft).ServiceID == serviceID })
+	if err != nil {
+		return false, err
+	}
+
+	return tokenId != "", nil
+}
+
+// ValidBalanceOfByURI counts the non-fungible tokens of an owner with the given URI that are valid at the time of the transaction
+// param {String} owner An owner for whom to count the tokens
+// param {String} tokenURI The URI the tokens must have
+// returns {Number} Return the number of matching valid tokens
+func (c *TokenERC721Contract) ValidBalanceOfByURI(ctx contractapi.TransactionContextInterface, owner string, tokenURI string) (int, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	now, err := _txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	nfts, err := _tokensOfOwner(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	balance := 0
+	for _, nft := range nfts {
+		if nft.TokenURI == tokenURI && _isCardValidAt(nft, now) {
+			balance++
+		}
+	}
+
+	return balance, nil
+}
+
+// RenewCard moves the expiry of a card. Only the identity that issued the card may renew it,
+// and only while its MSP may still mint cards for the service of the card.
+// param {String} tokenId The identifier for a non-fungible token
+// param {Number} notAfter Unix time until which the card is valid, 0 for no expiry
+// returns {Object} Return the renewed non-fungible token object
+func (c *TokenERC721Contract) RenewCard(ctx contractapi.TransactionContextInterface, tokenId string, notAfter int64) (*Nft, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if !_nftExists(ctx, tokenId) {
+		return nil, fmt.Errorf("the token %s does not exist", tokenId)
+	}
+
+	nft, err := _readNFT(ctx, tokenId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to _readNFT: %v", err)
+	}
+
+	sender, err := GetClientIdentity(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetClientIdentity: %v", err)
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clientMSPID: %v", err)
+	}
+
+	// Cards minted before cards had an issuer may be renewed by the owner org of the contract
+	if nft.Issuer != "" {
+		if sender != nft.Issuer {
+			return nil, fmt.Errorf("the sender is not the issuer of card %s", tokenId)
+		}
+	} else {
+		ownerMSPID, err := c.OwnerMSPID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ownerMSPID: %v", err)
+		}
+		if clientMSPID != ownerMSPID {
+			return nil, fmt.Errorf("the sender is not the issuer of card %s", tokenId)
+		}
+	}
+
+	// Check that the issuer still holds the minter role for the service of the card
+	serviceID := _cardMetadata(nft).ServiceID
+	isMinter, err := _isMinter(ctx, clientMSPID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMinter {
+		return nil, fmt.Errorf("client from org %s is not authorized to mint cards for service %s", clientMSPID, serviceID)
+	}
+
+	if notAfter != 0 && notAfter < nft.NotBefore {
+		return nil, fmt.Errorf("the card would expire at %d before it is valid at %d", notAfter, nft.NotBefore)
+	}
+
+	nft.NotAfter = notAfter
+
+	nftKey, err := ctx.GetStub().CreateCompositeKey(nftPrefix, []string{tokenId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateCompositeKey: %v", err)
+	}
+
+	nftBytes, err := json.Marshal(nft)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal nft: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(nftKey, nftBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to PutState nftBytes %s: %v", nftBytes, err)
+	}
+
+	return nft, nil
+}
+
+// _txTimestamp returns the time of the transaction in Unix seconds, which is the same on every endorsing peer
+func _txTimestamp(ctx contractapi.TransactionContextInterface) (int64, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to GetTxTimestamp: %v", err)
+	}
+
+	return timestamp.GetSeconds(), nil
+}
+
+func _isCardValidAt(nft *Nft, now int64) bool {
+	if nft.NotBefore != 0 && now < nft.NotBefore {
+		return false
+	}
+	if nft.NotAfter != 0 && now > nft.NotAfter {
+		return false
+	}
+	return true
+}
+
+// _validTokenOfOwner returns the first card of an owner that matches and is valid
+// at the time of the transaction, or an empty string if the owner holds none
+func _validTokenOfOwner(ctx contractapi.TransactionContextInterface, owner string, match func(nft *Nft) bool) (string, error) {
+	now, err := _txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	nfts, err := _tokensOfOwner(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+
+	for _, nft := range nfts {
+		if match(nft) && _isCardValidAt(nft, now) {
+			return nft.TokenId, nil
+		}
+	}
+
+	return "", nil
+}
+
+// _tokensOfOwner reads every non-fungible token of an owner
+func _tokensOfOwner(ctx contractapi.TransactionContextInterface, owner string) ([]*Nft, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(balancePrefix, []string{owner})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetStateByPartialCompositeKey: %v", err)
+	}
+	defer iterator.Close()
+
+	nfts := []*Nft{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next balance key: %v", err)
+		}
+
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to SplitCompositeKey %s: %v", response.Key, err)
+		}
+
+		nft, err := _readNFT(ctx, compositeKeyParts[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to _readNFT: %v", err)
+		}
+		nfts = append(nfts, nft)
+	}
+
+	return nfts, nil
+}
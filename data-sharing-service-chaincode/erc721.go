@@ -10,11 +10,55 @@ import (
 )
 
 // Define structs to be used by chaincode
+// A NotBefore or NotAfter of 0 leaves the validity of the card unbounded on that side,
+// and a UsageAllowance of 0 leaves its usage unmetered
 type Nft struct {
-	TokenId  string `json:"tokenId"`
-	Owner    string `json:"owner"`
-	TokenURI string `json:"tokenURI"`
-	Approved string `json:"approved"`
+	TokenId        string        `json:"tokenId"`
+	Owner          string        `json:"owner"`
+	TokenURI       string        `json:"tokenURI"`
+	Approved       string        `json:"approved"`
+	Issuer         string        `json:"issuer"`
+	NotBefore      int64         `json:"notBefore"`
+	NotAfter       int64         `json:"notAfter"`
+	UsageAllowance int           `json:"usageAllowance"`
+	UsageConsumed  int           `json:"usageConsumed"`
+	Metadata       *CardMetadata `json:"metadata" metadata:",optional"`
+}
+
+// Cards minted before cards had metadata have none, their service is their TokenURI
+type CardMetadata struct {
+	ServiceID  string            `json:"serviceID"`
+	Tier       string            `json:"tier"`
+	Scopes     []string          `json:"scopes" metadata:",optional"`
+	Issuer     string            `json:"issuer"`
+	Attributes map[string]string `json:"attributes" metadata:",optional"`
+}
+
+// BackingTables are the hashes of the names of the tables the service queries, as in the query chaincode.
+// A query against the service costs Price plus PricePerRow for every returned row, in credits of the
+// query chaincode paid to OwnerID, the client that registered the service.
+type Service struct {
+	ServiceID       string   `json:"serviceID"`
+	ProviderMSPID   string   `json:"providerMSPID"`
+	OwnerID         string   `json:"ownerID"`
+	Description     string   `json:"description"`
+	BackingTables   []string `json:"backingTables" metadata:",optional"`
+	ParameterSchema string   `json:"parameterSchema"`
+	Price           int      `json:"price"`
+	PricePerRow     int      `json:"pricePerRow"`
+	Status          string   `json:"status"`
+}
+
+// A minter without Services may mint cards for every service
+type Minter struct {
+	MSPID    string   `json:"mspID"`
+	Services []string `json:"services" metadata:",optional"`
+}
+
+type MinterChange struct {
+	MSPID    string   `json:"mspID"`
+	Services []string `json:"services"`
+	Granted  bool     `json:"granted"`
 }
 
 type Approval struct {
@@ -23,10 +67,36 @@ type Approval struct {
 	Approved bool   `json:"approved"`
 }
 
+// Data is the opaque payload of SafeTransferFrom. Other transfers carry none, so it is left out of their events.
 type Transfer struct {
 	From    string `json:"from"`
 	To      string `json:"to"`
 	TokenId string `json:"tokenId"`
+	Data    string `json:"data,omitempty" metadata:",optional"`
+}
+
+type UsageConsumed struct {
+	TokenId   string `json:"tokenId"`
+	Operator  string `json:"operator"`
+	Amount    int    `json:"amount"`
+	Remaining int    `json:"remaining"`
+}
+
+type BatchTransfer struct {
+	Transfers []*Transfer `json:"transfers"`
+}
+
+type NftHistoryRecord struct {
+	TxId      string `json:"txId"`
+	Timestamp int64  `json:"timestamp"`
+	IsDelete  bool   `json:"isDelete"`
+	Record    *Nft   `json:"record" metadata:",optional"`
+}
+
+type PaginatedNftResult struct {
+	Records             []*Nft `json:"records"`
+	FetchedRecordsCount int32  `json:"fetchedRecordsCount"`
+	Bookmark            string `json:"bookmark"`
 }
 
 func main() {
@@ -37,6 +107,7 @@ func main() {
 	nftContract.Info.License.Name = "Apache-2.0"
 	nftContract.Info.Contact = new(metadata.ContactMetadata)
 	nftContract.Info.Contact.Name = "Matias Salimbene"
+	nftContract.BeforeTransaction = cardPolicies.BeforeTransaction()
 
 	chaincode, err := contractapi.NewChaincode(nftContract)
 	chaincode.Info.Title = "ERC-721 chaincode"
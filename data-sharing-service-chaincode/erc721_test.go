@@ -0,0 +1,332 @@
+package main
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// Names used by the test network
+const testMSPID = "Org1MSP"
+const testServiceID = "service1"
+
+// testCA is the certificate authority of an MSP of the test network
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca.org1.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+// testClient is an enrolled client of the test network
+type testClient struct {
+	certPEM []byte
+	mspID   string
+}
+
+// enroll issues a certificate carrying attributes the way Fabric CA does
+func (ca *testCA) enroll(t *testing.T, commonName string, attrs map[string]string) *testClient {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: []string{"client"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if len(attrs) > 0 {
+		attrsBytes, err := json.Marshal(map[string]interface{}{"attrs": attrs})
+		require.NoError(t, err)
+		template.ExtraExtensions = []pkix.Extension{{Id: []int{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: attrsBytes}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return &testClient{
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		mspID:   testMSPID,
+	}
+}
+
+// testStub is a MockStub that pages through composite keys and records every write to answer GetHistoryForKey.
+// MockStub implements neither, and hands itself rather than a wrapper to the chaincode, so transactions
+// are run through invoke.
+type testStub struct {
+	*shimtest.MockStub
+	args      [][]byte
+	chaincode shim.Chaincode
+	history   map[string][]*queryresult.KeyModification
+}
+
+func newTestStub(name string, chaincode shim.Chaincode) *testStub {
+	return &testStub{
+		MockStub:  shimtest.NewMockStub(name, chaincode),
+		chaincode: chaincode,
+		history:   map[string][]*queryresult.KeyModification{},
+	}
+}
+
+// invoke runs a transaction like MockStub.MockInvoke. A failed transaction leaves no writes, as on the peers.
+func (s *testStub) invoke(txID string, args [][]byte) peer.Response {
+	state := map[string][]byte{}
+	for key, value := range s.State {
+		state[key] = value
+	}
+	keys := list.New()
+	keys.PushBackList(s.Keys)
+	history := map[string][]*queryresult.KeyModification{}
+	for key, modifications := range s.history {
+		history[key] = modifications
+	}
+
+	s.args = args
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+	response := s.chaincode.Invoke(s)
+	if response.Status != shim.OK {
+		s.State, s.Keys, s.history = state, keys, history
+	}
+	return response
+}
+
+func (s *testStub) PutState(key string, value []byte) error {
+	err := s.MockStub.PutState(key, value)
+	if err == nil {
+		s.history[key] = append(s.history[key], &queryresult.KeyModification{TxId: s.TxID, Value: value, Timestamp: s.TxTimestamp})
+	}
+	return err
+}
+
+func (s *testStub) DelState(key string) error {
+	err := s.MockStub.DelState(key)
+	if err == nil {
+		s.history[key] = append(s.history[key], &queryresult.KeyModification{TxId: s.TxID, Timestamp: s.TxTimestamp, IsDelete: true})
+	}
+	return err
+}
+
+// GetHistoryForKey returns the recorded writes of a key newest first, as the peers do
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	var modifications []*queryresult.KeyModification
+	for i := len(s.history[key]) - 1; i >= 0; i-- {
+		modifications = append(modifications, s.history[key][i])
+	}
+	return &testHistoryIterator{modifications: modifications}, nil
+}
+
+func (s *testStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *testStub) GetStringArgs() []string {
+	var args []string
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+// GetStateByPartialCompositeKeyWithPagination pages through composite keys like LevelDB does: a page starts
+// at the bookmark, and the bookmark of the next page is the key that follows it, empty after the last page
+func (s *testStub) GetStateByPartialCompositeKeyWithPagination(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	prefix, err := s.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	startKey := prefix
+	if bookmark != "" {
+		startKey = bookmark
+	}
+	iterator := shimtest.NewMockStateRangeQueryIterator(s.MockStub, startKey, prefix+string(utf8.MaxRune))
+
+	var results []*queryresult.KV
+	nextBookmark := ""
+	for iterator.HasNext() {
+		result, err := iterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(results) == int(pageSize) {
+			nextBookmark = result.Key
+			break
+		}
+		results = append(results, result)
+	}
+
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(results)), Bookmark: nextBookmark}
+	return &testIterator{results: results}, metadata, nil
+}
+
+// testIterator iterates over a fixed list of results
+type testIterator struct {
+	results []*queryresult.KV
+}
+
+func (it *testIterator) HasNext() bool {
+	return len(it.results) > 0
+}
+
+func (it *testIterator) Next() (*queryresult.KV, error) {
+	if len(it.results) == 0 {
+		return nil, errors.New("no more results")
+	}
+	result := it.results[0]
+	it.results = it.results[1:]
+	return result, nil
+}
+
+func (it *testIterator) Close() error {
+	return nil
+}
+
+// testHistoryIterator iterates over a fixed list of key modifications
+type testHistoryIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *testHistoryIterator) HasNext() bool {
+	return len(it.modifications) > 0
+}
+
+func (it *testHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.modifications) == 0 {
+		return nil, errors.New("no more results")
+	}
+	modification := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return modification, nil
+}
+
+func (it *testHistoryIterator) Close() error {
+	return nil
+}
+
+// testNetwork is the card chaincode on a MockStub, initialized by a minter of testMSPID
+// which has registered testServiceID
+type testNetwork struct {
+	ca     *testCA
+	minter *testClient
+	stub   *testStub
+	txs    int
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	nftContract := new(TokenERC721Contract)
+	nftContract.BeforeTransaction = cardPolicies.BeforeTransaction()
+	chaincode, err := contractapi.NewChaincode(nftContract)
+	require.NoError(t, err)
+
+	ca := newTestCA(t)
+	network := &testNetwork{
+		ca:     ca,
+		minter: ca.enroll(t, "minter", map[string]string{roleAttribute: "minter"}),
+		stub:   newTestStub("cards", chaincode),
+	}
+
+	network.mustInvoke(t, network.minter, "Initialize", "Cards", "CRD", testMSPID)
+	network.mustInvoke(t, network.minter, "RegisterService", testServiceID, "a test service", "[]", "", "0", "0")
+	return network
+}
+
+// invoke submits a transaction as the client and returns its payload, or its error message as an error
+func (n *testNetwork) invoke(t *testing.T, client *testClient, function string, args ...string) ([]byte, error) {
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: client.mspID, IdBytes: client.certPEM})
+	require.NoError(t, err)
+	n.stub.Creator = creator
+
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	n.txs++
+	response := n.stub.invoke(fmt.Sprintf("tx%d", n.txs), invokeArgs)
+	if response.Status != shim.OK {
+		return nil, errors.New(response.Message)
+	}
+	return response.Payload, nil
+}
+
+func (n *testNetwork) mustInvoke(t *testing.T, client *testClient, function string, args ...string) []byte {
+	payload, err := n.invoke(t, client, function, args...)
+	require.NoError(t, err, "%s(%v)", function, args)
+	return payload
+}
+
+// id returns the account ID of the client
+func (n *testNetwork) id(t *testing.T, client *testClient) string {
+	return string(n.mustInvoke(t, client, "ClientAccountID"))
+}
+
+// mintTo mints a card for testServiceID valid between notBefore and notAfter, and gives it to the owner
+func (n *testNetwork) mintTo(t *testing.T, owner *testClient, tokenId string, notBefore int64, notAfter int64) {
+	n.mustInvoke(t, n.minter, "MintWithTokenURI", tokenId, testServiceID, "", fmt.Sprint(notBefore), fmt.Sprint(notAfter), "0")
+	n.mustInvoke(t, n.minter, "TransferFrom", n.id(t, n.minter), n.id(t, owner), tokenId)
+}
+
+func TestBalanceOfByURI(t *testing.T) {
+	network := newTestNetwork(t)
+	user := network.ca.enroll(t, "user1", nil)
+	network.mintTo(t, user, "card1", 0, 0)
+	network.mintTo(t, user, "card2", 0, 1)
+	network.mintTo(t, user, "card3", time.Now().Add(time.Hour).Unix(), 0)
+
+	balance := network.mustInvoke(t, user, "BalanceOfByURI", network.id(t, user), testServiceID)
+	require.Equal(t, "3", string(balance))
+
+	balance = network.mustInvoke(t, user, "ValidBalanceOfByURI", network.id(t, user), testServiceID)
+	require.Equal(t, "1", string(balance))
+	balance = network.mustInvoke(t, user, "ValidBalanceOfByURI", network.id(t, user), "service2")
+	require.Equal(t, "0", string(balance))
+}